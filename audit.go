@@ -0,0 +1,58 @@
+package psqltoolbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// AuditEvent is the JSON line written to an AuditWriter for each destructive
+// operation, such as a reset by DropTablesAndMigrateWithOptions or a
+// DropDatabaseWithOptions.
+type AuditEvent struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	// Target is the URL operated on, with the password redacted.
+	Target string `json:"target"`
+	// Objects lists what was dropped, as kind and qualified name, e.g.
+	// "table public.users".
+	Objects []string `json:"objects"`
+	// Outcome is "success" or "failure"; Error holds the failure.
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// audit writes an AuditEvent for operation to w, if non-nil, and returns
+// opErr, the operation's own result. The event is written in a single Write
+// so that concurrent operations sharing w do not interleave their lines. A
+// failure to write is returned alongside opErr, as an operation that cannot
+// be audited should not pass silently.
+func audit(w io.Writer, operation, target string, objects []string, opErr error) error {
+	if w == nil {
+		return opErr
+	}
+	ev := AuditEvent{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Target:    RedactURL(target),
+		Objects:   objects,
+		Outcome:   "success",
+	}
+	if ev.Objects == nil {
+		ev.Objects = []string{}
+	}
+	if opErr != nil {
+		ev.Outcome = "failure"
+		ev.Error = opErr.Error()
+	}
+	b, err := json.Marshal(ev)
+	if err == nil {
+		_, err = w.Write(append(b, '\n'))
+	}
+	if err != nil {
+		return errors.Join(opErr, fmt.Errorf("audit log: %w", err))
+	}
+	return opErr
+}
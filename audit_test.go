@@ -0,0 +1,143 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// readAuditEvent decodes the single JSON line written to buf.
+func readAuditEvent(t *testing.T, buf *bytes.Buffer) AuditEvent {
+	t.Helper()
+	line := buf.String()
+	if strings.Count(line, "\n") != 1 || !strings.HasSuffix(line, "\n") {
+		t.Fatalf("expected one JSON line, got %q", line)
+	}
+	var ev AuditEvent
+	if err := json.Unmarshal([]byte(line), &ev); err != nil {
+		t.Fatalf("malformed audit line %q: %v", line, err)
+	}
+	if ev.Time.IsZero() {
+		t.Fatalf("expected a timestamp, got %q", line)
+	}
+	if strings.Contains(line, "secret") || !strings.Contains(ev.Target, "****") {
+		t.Fatalf("expected a redacted target, got %q", line)
+	}
+	return ev
+}
+
+func TestDropDatabase_Audit(t *testing.T) {
+	const adminURL = "postgres://u:secret@h:5432/postgres"
+	var buf bytes.Buffer
+	opts := DropDatabaseOptions{AuditWriter: &buf}
+
+	conn := &fakeConn{}
+	if err := dropDatabase(context.Background(), adminURL, "app_test", opts, connectTo(conn)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ev := readAuditEvent(t, &buf)
+	if ev.Operation != "drop database" || ev.Outcome != "success" || ev.Error != "" {
+		t.Fatalf("unexpected audit event: %+v", ev)
+	}
+	if !slices.Equal(ev.Objects, []string{"database app_test"}) {
+		t.Fatalf("unexpected objects %v", ev.Objects)
+	}
+
+	buf.Reset()
+	conn = &fakeConn{execErr: &pgconn.PgError{Code: pgInvalidCatalog}}
+	err := dropDatabase(context.Background(), adminURL, "app_test", opts, connectTo(conn))
+	if !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("expected ErrDatabaseNotFound, got %v", err)
+	}
+	ev = readAuditEvent(t, &buf)
+	if ev.Outcome != "failure" || ev.Error != err.Error() || len(ev.Objects) != 0 {
+		t.Fatalf("expected a failure event without objects, got %+v", ev)
+	}
+}
+
+func TestResetDatabase_Audit(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		dbObject{Kind: "VIEW", Schema: "public", Name: "active_users"},
+	)}
+	opts := ResetOptions{
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		DropViews:   true,
+		AuditWriter: &buf,
+	}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:secret@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ev := readAuditEvent(t, &buf)
+	if ev.Operation != "drop tables and migrate" || ev.Outcome != "success" {
+		t.Fatalf("unexpected audit event: %+v", ev)
+	}
+	if want := []string{"view public.active_users", "table public.users"}; !slices.Equal(ev.Objects, want) {
+		t.Fatalf("unexpected objects %v", ev.Objects)
+	}
+
+	// dry runs change nothing and are not audited
+	buf.Reset()
+	opts.DryRun = true
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:secret@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("expected no audit line for a dry run, got %q", buf.String())
+	}
+}
+
+// Test that a drop failing partway still audits the objects it removed.
+func TestResetDatabase_AuditPartialDrop(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &fakeConn{
+		rowsFor: catalogRows(
+			dbObject{Kind: "TABLE", Schema: "public", Name: "orders"},
+			dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		),
+		execErrOn: func(sql string) bool { return strings.Contains(sql, `"users"`) },
+	}
+	opts := ResetOptions{
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		AuditWriter: &buf,
+	}
+	_, err := resetDatabase(context.Background(), conn, "postgres://u:secret@h:1234/db", "", opts)
+	if err == nil {
+		t.Fatalf("expected the drop to fail")
+	}
+	ev := readAuditEvent(t, &buf)
+	if ev.Outcome != "failure" || ev.Error != err.Error() {
+		t.Fatalf("expected a failure event, got %+v", ev)
+	}
+	if !slices.Equal(ev.Objects, []string{"table public.orders"}) {
+		t.Fatalf("expected the table dropped before the failure, got %v", ev.Objects)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+// Test that a failed audit write is reported even when the operation worked.
+func TestAudit_WriteError(t *testing.T) {
+	err := audit(failingWriter{}, "drop database", "postgres://u:p@h/db", nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "audit log: disk full") {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	opErr := errors.New("boom")
+	if err := audit(failingWriter{}, "drop database", "postgres://u:p@h/db", nil, opErr); !errors.Is(err, opErr) {
+		t.Fatalf("expected the operation error to be kept, got %v", err)
+	}
+	if err := audit(nil, "drop database", "postgres://u:p@h/db", nil, opErr); err != opErr {
+		t.Fatalf("expected a nil writer to pass the error through, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package psqltoolbox
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// ChecksumPath returns the path of the SHA-256 sidecar for outFile.
+func ChecksumPath(outFile string) string {
+	return outFile + ".sha256"
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 of the file at path.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksumFile writes sum for outFile in the format of sha256sum, so
+// `sha256sum -c` run from the dump's directory verifies it.
+func writeChecksumFile(outFile, sum string) error {
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(outFile))
+	return os.WriteFile(ChecksumPath(outFile), []byte(line), 0o644)
+}
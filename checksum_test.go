@@ -0,0 +1,76 @@
+package psqltoolbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDumpSum is the sha256sum of the output written by writeFakeDumpOutput.
+const fakeDumpSum = "949e4ec9b94315180e80db9c738a90cd37f3615f19c41764bdefaa6ba52834fe"
+
+// writeFakeDumpOutput writes a fake pg_dump that writes "fake dump\n" to its
+// -f file, or to stdout without one.
+func writeFakeDumpOutput(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	script := `#!/usr/bin/env bash
+out=
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-f" ]; then out=$2; fi
+	shift
+done
+if [ -n "$out" ]; then printf 'fake dump\n' > "$out"; else printf 'fake dump\n'; fi
+`
+	if err := os.WriteFile(filepath.Join(dir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+	return dir
+}
+
+func TestPgDump_Checksum(t *testing.T) {
+	dir := writeFakeDumpOutput(t)
+	outFile := filepath.Join(t.TempDir(), "app.dump")
+	var fileSum, streamSum string
+
+	withPathPrepended(dir, func() {
+		opts := PgDumpOptions{WriteChecksum: true, Checksum: func(sum string) { fileSum = sum }}
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions: %v", err)
+		}
+
+		var buf strings.Builder
+		opts = PgDumpOptions{Checksum: func(sum string) { streamSum = sum }}
+		if err := PgDumpToWriterWithOptions(context.Background(), "postgres://u:p@h:1234/db", &buf, 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToWriterWithOptions: %v", err)
+		}
+		if buf.String() != "fake dump\n" {
+			t.Fatalf("unexpected stream contents: %q", buf.String())
+		}
+	})
+
+	if fileSum != fakeDumpSum || streamSum != fakeDumpSum {
+		t.Fatalf("got checksums %q (file) and %q (stream), want %q", fileSum, streamSum, fakeDumpSum)
+	}
+	b, err := os.ReadFile(ChecksumPath(outFile))
+	if err != nil {
+		t.Fatalf("read sidecar: %v", err)
+	}
+	if want := fakeDumpSum + "  app.dump\n"; string(b) != want {
+		t.Fatalf("sidecar %q, want %q", b, want)
+	}
+}
+
+func TestPgDump_ChecksumRejected(t *testing.T) {
+	err := PgDumpToWriterWithOptions(context.Background(), "postgres://u:p@h:1234/db", &strings.Builder{}, time.Second, PgDumpOptions{WriteChecksum: true})
+	if err == nil {
+		t.Fatalf("expected WriteChecksum without an output file to be rejected")
+	}
+	err = PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", t.TempDir(), time.Second, PgDumpOptions{Format: DumpFormatDirectory, Checksum: func(string) {}})
+	if err == nil {
+		t.Fatalf("expected a directory-format checksum to be rejected")
+	}
+}
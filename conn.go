@@ -0,0 +1,46 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// WithConnection connects to dbURL, runs fn on the connection and closes it
+// again, even if fn panics. When timeout is positive it bounds connecting and
+// fn together through the context passed to fn. fn's error is returned as is;
+// failing to parse dbURL or to connect wraps ErrInvalidURL or
+// ErrConnectFailed.
+func WithConnection(ctx context.Context, dbURL string, timeout time.Duration, fn func(ctx context.Context, conn *pgx.Conn) error) error {
+	return withConn(ctx, dbURL, timeout, pgxConnect, func(ctx context.Context, conn closableConn) error {
+		return fn(ctx, conn.(*pgx.Conn))
+	})
+}
+
+// withConn is WithConnection with an injectable connector. A zero timeout
+// leaves ctx as is.
+func withConn(ctx context.Context, dbURL string, timeout time.Duration, connect connector, fn func(context.Context, closableConn) error) error {
+	return withTLSConn(ctx, dbURL, TLSOptions{}, timeout, connect, fn)
+}
+
+// withTLSConn is withConn with the TLS overrides in tlsOpts applied.
+func withTLSConn(ctx context.Context, dbURL string, tlsOpts TLSOptions, timeout time.Duration, connect connector, fn func(context.Context, closableConn) error) error {
+	cfg, err := PgxConfig(dbURL, tlsOpts)
+	if err != nil {
+		return err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	conn, err := connect(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConnectFailed, err)
+	}
+	defer conn.Close(context.Background())
+
+	return fn(ctx, conn)
+}
@@ -0,0 +1,78 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestWithConn(t *testing.T) {
+	const dbURL = "postgres://u:p@h:1234/db"
+	conn := &fakeConn{}
+	connect := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+	errBoom := errors.New("boom")
+
+	err := withConn(context.Background(), dbURL, time.Minute, connect, func(ctx context.Context, c closableConn) error {
+		if c != conn {
+			t.Fatalf("fn got a different connection")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			t.Fatalf("expected the timeout to bound fn's context")
+		}
+		if conn.closed {
+			t.Fatalf("connection closed before fn returned")
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("expected fn's error, got %v", err)
+	}
+	if !conn.closed {
+		t.Fatalf("expected connection to be closed after fn returned")
+	}
+
+	refused := func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+		return nil, errors.New("connection refused")
+	}
+	called := false
+	err = withConn(context.Background(), dbURL, 0, refused, func(context.Context, closableConn) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrConnectFailed) || called {
+		t.Fatalf("expected ErrConnectFailed without calling fn, got %v (called=%v)", err, called)
+	}
+}
+
+// Test that the connection is closed when fn panics.
+func TestWithConn_Panic(t *testing.T) {
+	conn := &fakeConn{}
+	connect := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the panic to propagate")
+			}
+		}()
+		withConn(context.Background(), "postgres://u:p@h:1234/db", 0, connect, func(context.Context, closableConn) error {
+			panic("fn failed")
+		})
+	}()
+	if !conn.closed {
+		t.Fatalf("expected connection to be closed after a panic")
+	}
+}
+
+func TestWithConnection_InvalidURL(t *testing.T) {
+	err := WithConnection(context.Background(), "postgres://u:p@h:notaport/db", time.Second, func(context.Context, *pgx.Conn) error {
+		t.Fatalf("fn called for an invalid URL")
+		return nil
+	})
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", err)
+	}
+}
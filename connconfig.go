@@ -0,0 +1,470 @@
+package psqltoolbox
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ConnConfig holds the components of a PostgreSQL connection URL.
+type ConnConfig struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Database string
+
+	// Hosts lists every host of a failover URL such as
+	// postgres://u:p@primary:5432,standby:5432/db, in order. It is nil for a
+	// single host. Host and Port always hold the first entry, which is the
+	// one pg_dump and the other client tools connect to; pgx connections
+	// try the whole list.
+	Hosts []HostPort
+
+	// Params holds the URL query parameters such as sslmode, application_name
+	// and connect_timeout. When a key is repeated the last value wins, matching
+	// libpq.
+	Params map[string]string
+
+	// Raw is the original URL the config was parsed from, if any.
+	Raw string
+}
+
+// HostPort is one host of a multi-host connection URL.
+type HostPort struct {
+	Host string
+	Port string
+}
+
+// ParseConnConfig parses a PostgreSQL connection URL into a ConnConfig.
+// Both the postgres:// and postgresql:// schemes are accepted.
+// It validates that user, password, host, port and database are all non-empty
+// and returns an error otherwise. A host query parameter naming a directory,
+// as in postgres://app@/db?host=/var/run/postgresql, selects a Unix-domain
+// socket; the port then defaults to DefaultPort, the user to $PGUSER or the
+// OS user, and the password may be left out for peer authentication.
+func ParseConnConfig(raw string) (*ConnConfig, error) {
+	return ParseConnConfigWithOptions(raw, ParseOptions{})
+}
+
+// ParseConnConfigWithDefaults is like ParseConnConfig but fills in missing
+// components the way libpq would before validating: the port defaults to
+// DefaultPort, the user to $PGUSER and the database to $PGDATABASE.
+func ParseConnConfigWithDefaults(raw string) (*ConnConfig, error) {
+	return ParseConnConfigWithOptions(raw, ParseOptions{Defaults: true})
+}
+
+// ParseOptions relaxes the validation done by ParseConnConfigWithOptions.
+// The zero value matches ParseConnConfig.
+type ParseOptions struct {
+	// Defaults fills in missing components as ParseConnConfigWithDefaults
+	// does.
+	Defaults bool
+
+	// PasswordOptional accepts a URL without a password, leaving
+	// authentication to libpq's own mechanisms such as ~/.pgpass or an
+	// inherited PGPASSWORD environment variable.
+	PasswordOptional bool
+}
+
+// ParseConnConfigWithOptions is like ParseConnConfig but lets the caller
+// relax validation through opts.
+func ParseConnConfigWithOptions(raw string, opts ParseOptions) (*ConnConfig, error) {
+	return parseConnConfig(raw, opts)
+}
+
+// DefaultPort is the port PostgreSQL listens on unless configured otherwise.
+const DefaultPort = "5432"
+
+func parseConnConfig(raw string, opts ParseOptions) (*ConnConfig, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("%w: empty db url", ErrInvalidURL)
+	}
+	single, hosts, err := splitHostList(raw)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(single)
+	if err != nil {
+		// url.Error quotes the whole URL; keep the password out of it
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = RedactURL(uerr.URL)
+		}
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+	case "":
+		return nil, fmt.Errorf("%w: missing url scheme; expected postgres:// or postgresql://", ErrInvalidURL)
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+
+	cfg := &ConnConfig{Raw: raw}
+	if u.User != nil {
+		cfg.User = u.User.Username()
+		cfg.Password, _ = u.User.Password()
+	}
+	cfg.Host = u.Hostname()
+	cfg.Port = u.Port()
+	cfg.Hosts = hosts
+	cfg.Database = strings.TrimPrefix(u.Path, "/")
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse query: %w", ErrInvalidURL, err)
+	}
+	if len(query) > 0 {
+		cfg.Params = make(map[string]string, len(query))
+		for k, vs := range query {
+			cfg.Params[k] = vs[len(vs)-1]
+		}
+	}
+	if host := cfg.Params["host"]; strings.HasPrefix(host, "/") {
+		// libpq's form for a Unix-domain socket: the host names the
+		// directory holding the socket, and the port picks its file name
+		cfg.Host = host
+		delete(cfg.Params, "host")
+		if port, ok := cfg.Params["port"]; ok {
+			cfg.Port = port
+			delete(cfg.Params, "port")
+		}
+		if cfg.Port == "" {
+			cfg.Port = DefaultPort
+		}
+		// peer authentication over the socket needs neither a user in the
+		// URL nor a password
+		if cfg.User == "" {
+			if cfg.User, err = defaultUser(); err != nil {
+				return nil, err
+			}
+		}
+		opts.PasswordOptional = true
+	}
+
+	if opts.Defaults {
+		if cfg.Port == "" {
+			cfg.Port = DefaultPort
+		}
+		for i := range cfg.Hosts {
+			if cfg.Hosts[i].Port == "" {
+				cfg.Hosts[i].Port = DefaultPort
+			}
+		}
+		if cfg.User == "" {
+			cfg.User = os.Getenv("PGUSER")
+		}
+		if cfg.Database == "" {
+			cfg.Database = os.Getenv("PGDATABASE")
+		}
+	}
+
+	if err := cfg.validate(opts.PasswordOptional); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that a config built by hand, e.g. from flags, is as
+// complete as ParseConnConfig requires: user, password, host, port and
+// database must be non-empty and the port a number from 1 to 65535. Errors
+// wrap ErrInvalidURL.
+func (c *ConnConfig) Validate() error {
+	return c.validate(false)
+}
+
+// validate implements Validate, optionally accepting an empty password.
+func (c *ConnConfig) validate(passwordOptional bool) error {
+	var missing []string
+	for _, f := range []struct{ name, value string }{
+		{"user", c.User},
+		{"password", c.Password},
+		{"host", c.Host},
+		{"port", c.Port},
+		{"database", c.Database},
+	} {
+		if f.value == "" && (f.name != "password" || !passwordOptional) {
+			missing = append(missing, f.name)
+		}
+	}
+	if len(missing) > 0 {
+		what := "config"
+		if c.Raw != "" {
+			what = "URL"
+		}
+		// the password is named when missing but its value never shown
+		return fmt.Errorf("%w: missing required %s components: %s; got user=%q host=%q port=%q db=%q",
+			ErrInvalidURL, what, strings.Join(missing, ", "), c.User, c.Host, c.Port, c.Database)
+	}
+	if err := validatePort(c.Port); err != nil {
+		return err
+	}
+	for _, hp := range c.Hosts {
+		if hp.Host == "" {
+			return fmt.Errorf("%w: empty host in host list", ErrInvalidURL)
+		}
+		if err := validatePort(hp.Port); err != nil {
+			return fmt.Errorf("%w (host %s)", err, hp.Host)
+		}
+	}
+	return nil
+}
+
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("%w: port must be a number from 1 to 65535, got %q", ErrInvalidURL, port)
+	}
+	return nil
+}
+
+// splitHostList handles the comma-separated host lists of failover URLs,
+// which net/url cannot parse. It returns raw with only the first host left
+// in its authority, along with every host in order, or raw unchanged and no
+// hosts when it names a single host.
+func splitHostList(raw string) (string, []HostPort, error) {
+	scheme := strings.Index(raw, "://")
+	if scheme < 0 {
+		return raw, nil, nil
+	}
+	start := scheme + 3
+	end := len(raw)
+	if i := strings.IndexAny(raw[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	if at := strings.LastIndex(raw[start:end], "@"); at >= 0 {
+		start += at + 1
+	}
+	list := raw[start:end]
+	if !strings.Contains(list, ",") {
+		return raw, nil, nil
+	}
+
+	var hosts []HostPort
+	for _, entry := range strings.Split(list, ",") {
+		var hp HostPort
+		if rest, ok := strings.CutPrefix(entry, "["); ok {
+			host, port, ok := strings.Cut(rest, "]")
+			if !ok || (port != "" && !strings.HasPrefix(port, ":")) {
+				return "", nil, fmt.Errorf("%w: malformed host %q in host list", ErrInvalidURL, entry)
+			}
+			hp = HostPort{Host: host, Port: strings.TrimPrefix(port, ":")}
+		} else {
+			hp.Host, hp.Port, _ = strings.Cut(entry, ":")
+		}
+		if hp.Host == "" {
+			return "", nil, fmt.Errorf("%w: empty host in host list %q", ErrInvalidURL, list)
+		}
+		hosts = append(hosts, hp)
+	}
+	first := list[:strings.Index(list, ",")]
+	return raw[:start] + first + raw[end:], hosts, nil
+}
+
+// ConnConfigFromEnv builds a ConnConfig from the environment. DATABASE_URL is
+// used when set, with missing components defaulted as by
+// ParseConnConfigWithDefaults. Otherwise the config is assembled from PGHOST,
+// PGPORT, PGUSER, PGPASSWORD and PGDATABASE, defaulting to localhost, port
+// 5432, the current OS user and a database named after the user, and from
+// the PG* variables for the connection parameters in libpqEnvParams. The
+// password may be empty either way, leaving authentication to ~/.pgpass.
+func ConnConfigFromEnv() (*ConnConfig, error) {
+	if raw := os.Getenv("DATABASE_URL"); raw != "" {
+		cfg, err := ParseConnConfigWithOptions(raw, ParseOptions{Defaults: true, PasswordOptional: true})
+		if err != nil {
+			return nil, fmt.Errorf("DATABASE_URL: %w", err)
+		}
+		return cfg, nil
+	}
+
+	cfg := &ConnConfig{
+		Host:     envOr("PGHOST", "localhost"),
+		Port:     envOr("PGPORT", DefaultPort),
+		User:     os.Getenv("PGUSER"),
+		Password: os.Getenv("PGPASSWORD"),
+		Database: os.Getenv("PGDATABASE"),
+	}
+	if cfg.User == "" {
+		var err error
+		if cfg.User, err = defaultUser(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Database == "" {
+		cfg.Database = cfg.User
+	}
+	for key, name := range libpqEnvParams {
+		if v := os.Getenv(name); v != "" {
+			if cfg.Params == nil {
+				cfg.Params = make(map[string]string)
+			}
+			cfg.Params[key] = v
+		}
+	}
+	if err := cfg.validate(true); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// defaultUser returns the user libpq connects as when none is given: PGUSER,
+// or else the current OS user.
+func defaultUser() (string, error) {
+	if u := os.Getenv("PGUSER"); u != "" {
+		return u, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("%w: PGUSER not set and current user unknown: %w", ErrInvalidURL, err)
+	}
+	return u.Username, nil
+}
+
+// envOr returns the environment variable name, or def when it is unset or
+// empty.
+func envOr(name, def string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return def
+}
+
+// IsUnixSocket reports whether Host is the directory of a Unix-domain socket
+// rather than a network host, as with postgres:///db?host=/var/run/postgresql.
+func (c *ConnConfig) IsUnixSocket() bool {
+	return strings.HasPrefix(c.Host, "/")
+}
+
+// String rebuilds a postgres:// URL from the config fields. A Unix-domain
+// socket is written as host and port query parameters; Hosts after the first
+// follow Host and Port in a comma-separated list.
+func (c *ConnConfig) String() string {
+	u := &url.URL{
+		Scheme: "postgres",
+		Path:   "/" + c.Database,
+	}
+	q := url.Values{}
+	for k, v := range c.Params {
+		q.Set(k, v)
+	}
+	if c.IsUnixSocket() {
+		q.Set("host", c.Host)
+		if c.Port != "" {
+			q.Set("port", c.Port)
+		}
+	} else {
+		u.Host = joinHostPort(c.Host, c.Port)
+		for _, hp := range c.hosts()[1:] {
+			u.Host += "," + joinHostPort(hp.Host, hp.Port)
+		}
+	}
+	if len(q) > 0 {
+		u.RawQuery = q.Encode()
+	}
+	if c.User != "" {
+		if c.Password != "" {
+			u.User = url.UserPassword(c.User, c.Password)
+		} else {
+			u.User = url.User(c.User)
+		}
+	}
+	return u.String()
+}
+
+// PgxConfig builds a pgx connection config from the URL String returns, for
+// callers that want to tune pgx settings such as RuntimeParams or the
+// statement cache before passing it to pgx.ConnectConfig. It parses the URL
+// the same way the connections this package opens do. Failures wrap
+// ErrInvalidURL.
+func (c *ConnConfig) PgxConfig() (*pgx.ConnConfig, error) {
+	return PgxConfig(c.String(), TLSOptions{})
+}
+
+// hosts returns every host to connect to, starting with Host and Port.
+func (c *ConnConfig) hosts() []HostPort {
+	if len(c.Hosts) < 2 {
+		return []HostPort{{Host: c.Host, Port: c.Port}}
+	}
+	hosts := slices.Clone(c.Hosts)
+	hosts[0] = HostPort{Host: c.Host, Port: c.Port}
+	return hosts
+}
+
+// joinHostPort is net.JoinHostPort, except that an empty port is omitted
+// rather than leaving a trailing colon. IPv6 hosts are bracketed either way.
+func joinHostPort(host, port string) string {
+	if port != "" {
+		return net.JoinHostPort(host, port)
+	}
+	if strings.Contains(host, ":") {
+		return "[" + host + "]"
+	}
+	return host
+}
+
+// SSLMode returns the sslmode query parameter, or "" if it was not set.
+func (c *ConnConfig) SSLMode() string {
+	return c.Params["sslmode"]
+}
+
+// libpqEnvParams maps URL query parameters to the libpq environment variables
+// understood by pg_dump and friends.
+var libpqEnvParams = map[string]string{
+	"sslmode":          "PGSSLMODE",
+	"sslcert":          "PGSSLCERT",
+	"sslkey":           "PGSSLKEY",
+	"sslrootcert":      "PGSSLROOTCERT",
+	"sslnegotiation":   "PGSSLNEGOTIATION",
+	"channel_binding":  "PGCHANNELBINDING",
+	"application_name": "PGAPPNAME",
+	"connect_timeout":  "PGCONNECT_TIMEOUT",
+}
+
+// DefaultApplicationName is the application_name that connections and client
+// tools started by this package show in pg_stat_activity. The URL's own
+// application_name parameter overrides it, as does a PGAPPNAME set in the
+// environment.
+const DefaultApplicationName = "psqltoolbox"
+
+// defaultAppName returns the PGAPPNAME setting that gives a connection
+// without an application_name of its own DefaultApplicationName, or nil when
+// set is true or PGAPPNAME is already inherited.
+func defaultAppName(set bool) []string {
+	if set || os.Getenv("PGAPPNAME") != "" {
+		return nil
+	}
+	return []string{"PGAPPNAME=" + DefaultApplicationName}
+}
+
+// toolEnv returns the environment for running a libpq client tool against c:
+// the current process environment plus PGPASSWORD and any connection
+// parameters that libpq reads from the environment, with PGAPPNAME defaulting
+// to DefaultApplicationName. PGPASSWORD is only set when c has a password, so
+// an inherited value or ~/.pgpass still applies. extra is applied last and so
+// overrides all of these.
+func (c *ConnConfig) toolEnv(extra map[string]string) []string {
+	env := os.Environ()
+	if c.Password != "" {
+		env = append(env, "PGPASSWORD="+c.Password)
+	}
+	for key, name := range libpqEnvParams {
+		if v, ok := c.Params[key]; ok {
+			env = append(env, name+"="+v)
+		}
+	}
+	_, set := c.Params["application_name"]
+	env = append(env, defaultAppName(set)...)
+	for _, name := range slices.Sorted(maps.Keys(extra)) {
+		env = append(env, name+"="+extra[name])
+	}
+	return env
+}
@@ -0,0 +1,227 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL error codes for database-level DDL, for objects that no longer
+// exist and for statements cut short by lock_timeout or statement_timeout.
+const (
+	pgDuplicateDatabase = "42P04"
+	pgInvalidCatalog    = "3D000"
+	pgUndefinedTable    = "42P01"
+	pgUndefinedObject   = "42704"
+	pgInvalidSchemaName = "3F000"
+	pgLockNotAvailable  = "55P03"
+	pgQueryCanceled     = "57014"
+)
+
+// Errors returned by CreateDatabase and DropDatabase.
+var (
+	ErrDatabaseExists   = errors.New("database already exists")
+	ErrDatabaseNotFound = errors.New("database does not exist")
+)
+
+// CreateDatabase connects to the maintenance database in adminURL (typically
+// .../postgres) and creates dbName. It returns an error wrapping
+// ErrDatabaseExists if the database is already there.
+func CreateDatabase(ctx context.Context, adminURL, dbName string) error {
+	return createDatabase(ctx, adminURL, dbName, pgxConnect)
+}
+
+// DropDatabase connects to the maintenance database in adminURL and drops
+// dbName. With force, existing connections to it are terminated first via
+// WITH (FORCE), which requires PostgreSQL 13 or later. It returns an error
+// wrapping ErrDatabaseNotFound if there is no such database.
+func DropDatabase(ctx context.Context, adminURL, dbName string, force bool) error {
+	return DropDatabaseWithOptions(ctx, adminURL, dbName, DropDatabaseOptions{Force: force})
+}
+
+// DropDatabaseOptions controls DropDatabaseWithOptions.
+type DropDatabaseOptions struct {
+	// Force terminates existing connections first, as in DropDatabase.
+	Force bool
+
+	// AuditWriter, when set, receives an AuditEvent as a JSON line once the
+	// drop has finished or failed.
+	AuditWriter io.Writer
+}
+
+// DropDatabaseWithOptions is like DropDatabase but configurable through opts.
+func DropDatabaseWithOptions(ctx context.Context, adminURL, dbName string, opts DropDatabaseOptions) error {
+	return dropDatabase(ctx, adminURL, dbName, opts, pgxConnect)
+}
+
+// CloneDatabase creates newName as a copy of templateName using CREATE
+// DATABASE ... TEMPLATE, which is much faster than migrating and seeding a
+// fresh database. PostgreSQL refuses to copy a template that has other
+// sessions, so those are terminated first.
+func CloneDatabase(ctx context.Context, adminURL, templateName, newName string) error {
+	return cloneDatabase(ctx, adminURL, templateName, newName, pgxConnect)
+}
+
+// TerminateConnections ends every session connected to dbName other than
+// adminConn's own and returns how many were terminated. adminConn should be
+// connected to a different database, typically the maintenance database, and
+// needs superuser rights or membership in pg_signal_backend.
+func TerminateConnections(ctx context.Context, adminConn Querier, dbName string) (int, error) {
+	return terminateConnections(ctx, adminConn, dbName)
+}
+
+// EnsureDatabase connects to the maintenance database in adminURL and creates
+// dbName unless it already exists, reporting whether it was created.
+func EnsureDatabase(ctx context.Context, adminURL, dbName string) (created bool, err error) {
+	return ensureDatabase(ctx, adminURL, dbName, pgxConnect)
+}
+
+// EnsureDatabaseAndMigrate prepares a brand-new environment in one call: it
+// creates the database named in dbURL through the maintenance database in
+// adminURL if it does not exist yet, then applies the pending migrations in
+// migrationsPath with the migrate CLI, as DropTablesAndMigrate does but
+// without dropping anything.
+func EnsureDatabaseAndMigrate(ctx context.Context, adminURL, dbURL, migrationsPath string) error {
+	return ensureDatabaseAndMigrate(ctx, adminURL, dbURL, migrationsPath, pgxConnect)
+}
+
+func ensureDatabaseAndMigrate(ctx context.Context, adminURL, dbURL, migrationsPath string, connect connector) error {
+	cfg, err := PgxConfig(dbURL, TLSOptions{})
+	if err != nil {
+		return err
+	}
+	if err := checkMigrationsDir(migrationsPath); err != nil {
+		return err
+	}
+	if _, err := ensureDatabase(ctx, adminURL, cfg.Database, connect); err != nil {
+		return err
+	}
+	return runMigrate(ctx, MigrateOptions{}, dbURL, migrationsPath, "up")
+}
+
+// databaseExistsSQL reports whether database $1 exists.
+const databaseExistsSQL = `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`
+
+func ensureDatabase(ctx context.Context, adminURL, dbName string, connect connector) (created bool, err error) {
+	err = withConn(ctx, adminURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		exists, err := scalar[bool](ctx, conn, databaseExistsSQL, dbName)
+		if err != nil || exists {
+			return err
+		}
+		_, err = conn.Exec(ctx, "CREATE DATABASE "+pgx.Identifier{dbName}.Sanitize())
+		// losing a race with another creator still leaves the database there
+		if pgErrCode(err) == pgDuplicateDatabase {
+			return nil
+		}
+		created = err == nil
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("ensure database %q: %w", dbName, err)
+	}
+	return created, nil
+}
+
+func createDatabase(ctx context.Context, adminURL, dbName string, connect connector) error {
+	sql := "CREATE DATABASE " + pgx.Identifier{dbName}.Sanitize()
+	if err := execAdmin(ctx, adminURL, sql, connect); err != nil {
+		if pgErrCode(err) == pgDuplicateDatabase {
+			return fmt.Errorf("create database %q: %w", dbName, ErrDatabaseExists)
+		}
+		return fmt.Errorf("create database %q: %w", dbName, err)
+	}
+	return nil
+}
+
+func dropDatabase(ctx context.Context, adminURL, dbName string, opts DropDatabaseOptions, connect connector) (err error) {
+	defer func() {
+		var objects []string
+		if err == nil {
+			objects = []string{"database " + dbName}
+		}
+		err = audit(opts.AuditWriter, "drop database", adminURL, objects, err)
+	}()
+
+	sql := "DROP DATABASE " + pgx.Identifier{dbName}.Sanitize()
+	if opts.Force {
+		sql += " WITH (FORCE)"
+	}
+	if err := execAdmin(ctx, adminURL, sql, connect); err != nil {
+		if pgErrCode(err) == pgInvalidCatalog {
+			return fmt.Errorf("drop database %q: %w", dbName, ErrDatabaseNotFound)
+		}
+		return fmt.Errorf("drop database %q: %w", dbName, err)
+	}
+	return nil
+}
+
+func cloneDatabase(ctx context.Context, adminURL, templateName, newName string, connect connector) error {
+	return withConn(ctx, adminURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		return cloneFromTemplate(ctx, conn, templateName, newName)
+	})
+}
+
+// cloneFromTemplate ends the sessions on templateName, which would block the
+// copy, and creates newName from it.
+func cloneFromTemplate(ctx context.Context, conn dbConn, templateName, newName string) error {
+	if _, err := terminateConnections(ctx, conn, templateName); err != nil {
+		return fmt.Errorf("clone database %q: %w", templateName, err)
+	}
+	sql := "CREATE DATABASE " + pgx.Identifier{newName}.Sanitize() + " TEMPLATE " + pgx.Identifier{templateName}.Sanitize()
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		switch pgErrCode(err) {
+		case pgDuplicateDatabase:
+			return fmt.Errorf("clone database %q into %q: %w", templateName, newName, ErrDatabaseExists)
+		case pgInvalidCatalog:
+			return fmt.Errorf("clone database %q into %q: %w", templateName, newName, ErrDatabaseNotFound)
+		}
+		return fmt.Errorf("clone database %q into %q: %w", templateName, newName, err)
+	}
+	return nil
+}
+
+// terminateConnectionsSQL ends every session on database $1 other than our own.
+const terminateConnectionsSQL = `SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()`
+
+func terminateConnections(ctx context.Context, conn dbConn, dbName string) (int, error) {
+	rows, err := conn.Query(ctx, terminateConnectionsSQL, dbName)
+	if err != nil {
+		return 0, fmt.Errorf("terminate connections: %w", err)
+	}
+	// pg_terminate_backend reports false for a session that ended on its own
+	// in the meantime
+	terminated, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return 0, fmt.Errorf("terminate connections: %w", err)
+	}
+	n := 0
+	for _, ok := range terminated {
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// execAdmin runs a single statement on a fresh connection to adminURL. CREATE
+// and DROP DATABASE cannot run inside a transaction, so the statement is sent
+// on its own.
+func execAdmin(ctx context.Context, adminURL, sql string, connect connector) error {
+	return withConn(ctx, adminURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		_, err := conn.Exec(ctx, sql)
+		return err
+	})
+}
+
+// pgErrCode returns the SQLSTATE of err if it is a PostgreSQL error.
+func pgErrCode(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code
+	}
+	return ""
+}
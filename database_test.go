@@ -0,0 +1,135 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// connectTo returns a connector that always hands out conn.
+func connectTo(conn *fakeConn) connector {
+	return func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+}
+
+func TestCreateAndDropDatabase(t *testing.T) {
+	const adminURL = "postgres://u:p@h:5432/postgres"
+	conn := &fakeConn{}
+
+	if err := createDatabase(context.Background(), adminURL, `app"test`, connectTo(conn)); err != nil {
+		t.Fatalf("createDatabase: %v", err)
+	}
+	if err := dropDatabase(context.Background(), adminURL, "app_test", DropDatabaseOptions{}, connectTo(conn)); err != nil {
+		t.Fatalf("dropDatabase: %v", err)
+	}
+	if err := dropDatabase(context.Background(), adminURL, "app_test", DropDatabaseOptions{Force: true}, connectTo(conn)); err != nil {
+		t.Fatalf("dropDatabase force: %v", err)
+	}
+	want := []string{
+		`CREATE DATABASE "app""test"`,
+		`DROP DATABASE "app_test"`,
+		`DROP DATABASE "app_test" WITH (FORCE)`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+	if !conn.closed {
+		t.Fatalf("expected admin connection to be closed")
+	}
+}
+
+func TestCreateAndDropDatabase_FriendlyErrors(t *testing.T) {
+	const adminURL = "postgres://u:p@h:5432/postgres"
+
+	conn := &fakeConn{execErr: &pgconn.PgError{Code: pgDuplicateDatabase}}
+	if err := createDatabase(context.Background(), adminURL, "app", connectTo(conn)); !errors.Is(err, ErrDatabaseExists) {
+		t.Fatalf("expected ErrDatabaseExists, got %v", err)
+	}
+
+	conn = &fakeConn{execErr: &pgconn.PgError{Code: pgInvalidCatalog}}
+	if err := dropDatabase(context.Background(), adminURL, "app", DropDatabaseOptions{}, connectTo(conn)); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("expected ErrDatabaseNotFound, got %v", err)
+	}
+}
+
+func TestCloneDatabase(t *testing.T) {
+	conn := &fakeConn{}
+	if err := cloneDatabase(context.Background(), "postgres://u:p@h:5432/postgres", "app_template", "test-1", connectTo(conn)); err != nil {
+		t.Fatalf("cloneDatabase: %v", err)
+	}
+	want := []string{`CREATE DATABASE "test-1" TEMPLATE "app_template"`}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+	if len(conn.queries) != 1 || conn.queries[0].sql != terminateConnectionsSQL {
+		t.Fatalf("expected connections to be terminated first, got queries %v", conn.queries)
+	}
+	if args := conn.queries[0].args; len(args) != 1 || args[0] != "app_template" {
+		t.Fatalf("expected connections to app_template to be terminated, got args %v", args)
+	}
+}
+
+func TestTerminateConnections(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{
+		terminateConnectionsSQL: {{true}, {false}, {true}},
+	}}
+	n, err := terminateConnections(context.Background(), conn, "app_test")
+	if err != nil {
+		t.Fatalf("terminateConnections: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("got %d terminated, want 2", n)
+	}
+	if args := conn.queries[0].args; len(args) != 1 || args[0] != "app_test" {
+		t.Fatalf("unexpected query args %v", args)
+	}
+}
+
+func TestEnsureDatabaseAndMigrate(t *testing.T) {
+	const (
+		adminURL = "postgres://u:p@h:5432/postgres"
+		dbURL    = "postgres://u:p@h:5432/app"
+	)
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	migrations := writeMigrations(t)
+
+	for _, exists := range []bool{false, true} {
+		admin := &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+			if sql == databaseExistsSQL && args[0] == "app" {
+				return [][]any{{exists}}
+			}
+			return nil
+		}}
+		withPathPrepended(dir, func() {
+			if err := ensureDatabaseAndMigrate(context.Background(), adminURL, dbURL, migrations, connectTo(admin)); err != nil {
+				t.Fatalf("exists=%v: %v", exists, err)
+			}
+		})
+		var want []string
+		if !exists {
+			want = []string{`CREATE DATABASE "app"`}
+		}
+		if !slices.Equal(admin.execs, want) {
+			t.Fatalf("exists=%v: executed %v, want %v", exists, admin.execs, want)
+		}
+		args := readArgs(t, argsFile)
+		if db, _ := flagValue(args, "-database"); db != "postgres://u@h:5432/app" || args[len(args)-1] != "up" {
+			t.Fatalf("exists=%v: unexpected migrate args %v", exists, args)
+		}
+	}
+}
+
+// Test that a database created concurrently counts as existing.
+func TestEnsureDatabase_Race(t *testing.T) {
+	admin := &fakeConn{
+		rows:    map[string][][]any{databaseExistsSQL: {{false}}},
+		execErr: &pgconn.PgError{Code: pgDuplicateDatabase},
+	}
+	created, err := ensureDatabase(context.Background(), "postgres://u:p@h:5432/postgres", "app", connectTo(admin))
+	if err != nil || created {
+		t.Fatalf("expected an existing database without error, got created=%v err=%v", created, err)
+	}
+}
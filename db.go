@@ -0,0 +1,51 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Querier is the database handle accepted by the helpers in this package. It
+// is satisfied by *pgx.Conn, *pgxpool.Pool, *pgxpool.Conn and pgx.Tx, so
+// callers can pass whichever they already hold.
+type Querier interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+var (
+	_ Querier = (*pgx.Conn)(nil)
+	_ Querier = (*pgxpool.Pool)(nil)
+	_ Querier = (*pgxpool.Conn)(nil)
+	_ Querier = pgx.Tx(nil)
+)
+
+// dbConn is the subset of Querier used internally, which keeps test fakes
+// small.
+type dbConn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// withSessionConn calls fn with a single connection from q. When q is a
+// *pgxpool.Pool, a connection is acquired for the duration of fn so that
+// session state such as SET applies to every statement fn runs.
+func withSessionConn(ctx context.Context, q Querier, fn func(conn dbConn) error) error {
+	pool, ok := q.(*pgxpool.Pool)
+	if !ok {
+		return fn(q)
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: acquire connection: %w", ErrConnectFailed, err)
+	}
+	defer conn.Release()
+	return fn(conn)
+}
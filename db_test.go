@@ -0,0 +1,246 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// fakeQuery is a query received by fakeConn.
+type fakeQuery struct {
+	sql  string
+	args []any
+}
+
+// fakeConn is a dbConn that records executed SQL and answers queries from
+// rows, keyed by SQL. When rowsFor is set it takes precedence and can vary
+// the answer by argument.
+type fakeConn struct {
+	execs    []string
+	execArgs [][]any
+	queries  []fakeQuery
+	rows     map[string][][]any
+	rowsFor  func(sql string, args []any) [][]any
+	execErr  error
+
+	// execErrOn, when set, fails any Exec whose SQL it returns true for.
+	execErrOn func(sql string) bool
+
+	commits, rollbacks int
+	closed             bool
+}
+
+func (f *fakeConn) Close(context.Context) error {
+	f.closed = true
+	return nil
+}
+
+func (f *fakeConn) Begin(context.Context) (pgx.Tx, error) {
+	return &fakeTx{conn: f}, nil
+}
+
+func (f *fakeConn) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if f.execErrOn != nil && f.execErrOn(sql) {
+		return pgconn.CommandTag{}, fmt.Errorf("fake exec failure: %s", sql)
+	}
+	f.execs = append(f.execs, sql)
+	f.execArgs = append(f.execArgs, args)
+	return pgconn.CommandTag{}, f.execErr
+}
+
+// fakeTx buffers statements and applies them to conn only on Commit.
+// Methods not overridden here panic via the nil embedded pgx.Tx.
+type fakeTx struct {
+	pgx.Tx
+	conn    *fakeConn
+	pending []string
+	done    bool
+}
+
+func (t *fakeTx) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if t.conn.execErrOn != nil && t.conn.execErrOn(sql) {
+		return pgconn.CommandTag{}, fmt.Errorf("fake exec failure: %s", sql)
+	}
+	t.pending = append(t.pending, sql)
+	return pgconn.CommandTag{}, nil
+}
+
+func (t *fakeTx) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	return t.conn.Query(ctx, sql, args...)
+}
+
+func (t *fakeTx) Commit(context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	t.conn.commits++
+	t.conn.execs = append(t.conn.execs, t.pending...)
+	return nil
+}
+
+func (t *fakeTx) Rollback(context.Context) error {
+	if t.done {
+		return pgx.ErrTxClosed
+	}
+	t.done = true
+	t.conn.rollbacks++
+	return nil
+}
+
+func (f *fakeConn) Query(_ context.Context, sql string, args ...any) (pgx.Rows, error) {
+	f.queries = append(f.queries, fakeQuery{sql: sql, args: args})
+	rows := f.rows[sql]
+	if f.rowsFor != nil {
+		rows = f.rowsFor(sql, args)
+	}
+	return &fakeRows{rows: rows, idx: -1}, nil
+}
+
+func (f *fakeConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	rows, _ := f.Query(ctx, sql, args...)
+	return fakeRow{rows}
+}
+
+// fakeRow is the pgx.Row returned by fakeConn.QueryRow.
+type fakeRow struct{ rows pgx.Rows }
+
+func (r fakeRow) Scan(dest ...any) error {
+	if !r.rows.Next() {
+		return pgx.ErrNoRows
+	}
+	return r.rows.Scan(dest...)
+}
+
+// fakeRows is a pgx.Rows over in-memory values.
+type fakeRows struct {
+	rows [][]any
+	idx  int
+}
+
+func (r *fakeRows) Close()                                       {}
+func (r *fakeRows) Err() error                                   { return nil }
+func (r *fakeRows) CommandTag() pgconn.CommandTag                { return pgconn.CommandTag{} }
+func (r *fakeRows) FieldDescriptions() []pgconn.FieldDescription { return nil }
+func (r *fakeRows) RawValues() [][]byte                          { return nil }
+func (r *fakeRows) Conn() *pgx.Conn                              { return nil }
+
+func (r *fakeRows) Next() bool {
+	r.idx++
+	return r.idx < len(r.rows)
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return r.rows[r.idx], nil
+}
+
+func (r *fakeRows) Scan(dest ...any) error {
+	row := r.rows[r.idx]
+	if len(dest) != len(row) {
+		return fmt.Errorf("fakeRows: expected %d scan targets, got %d", len(row), len(dest))
+	}
+	for i, d := range dest {
+		var ok bool
+		switch d := d.(type) {
+		case *string:
+			*d, ok = row[i].(string)
+		case *int64:
+			*d, ok = row[i].(int64)
+		case *bool:
+			*d, ok = row[i].(bool)
+		case *any:
+			*d, ok = row[i], true
+		default:
+			return fmt.Errorf("fakeRows: unsupported scan target %T", d)
+		}
+		if !ok {
+			return fmt.Errorf("fakeRows: cannot scan %T into %T", row[i], d)
+		}
+	}
+	return nil
+}
+
+// catalogRows answers objectCategories list queries from objs, filtering by
+// the requested schema.
+func catalogRows(objs ...dbObject) func(string, []any) [][]any {
+	return func(sql string, args []any) [][]any {
+		var rows [][]any
+		for _, cat := range objectCategories {
+			if cat.listSQL != sql {
+				continue
+			}
+			for _, o := range objs {
+				if o.Schema == args[0] && categoryOf(o.Kind) == cat.name {
+					rows = append(rows, []any{o.Kind, o.Schema, o.Name, o.Args})
+				}
+			}
+		}
+		return rows
+	}
+}
+
+// categoryOf maps a DROP object kind to its objectCategories name.
+func categoryOf(kind string) string {
+	switch kind {
+	case "VIEW":
+		return "views"
+	case "MATERIALIZED VIEW":
+		return "materialized views"
+	case "TABLE":
+		return "tables"
+	case "SEQUENCE":
+		return "sequences"
+	case "FUNCTION", "PROCEDURE", "AGGREGATE":
+		return "functions"
+	default:
+		return "types"
+	}
+}
+
+// Test that the exported helpers accept any Querier, not just *pgx.Conn.
+func TestQuerier_FakeConn(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+	)}
+	var q Querier = conn
+	ctx := context.Background()
+
+	tables, err := ListTables(ctx, q, "public")
+	if err != nil || !slices.Equal(tables, []string{"users"}) {
+		t.Fatalf("ListTables: got %v, %v", tables, err)
+	}
+	opts := ResetOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), StatementTimeout: -1, LockTimeout: -1}
+	if _, err := DropTablesAndMigrateWithOptions(ctx, q, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("DropTablesAndMigrateWithOptions: %v", err)
+	}
+	if want := []string{`DROP TABLE IF EXISTS "public"."users" CASCADE`}; !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+}
+
+// Test that a pool is used through a single acquired connection, and that a
+// failure to acquire one is reported without calling fn.
+func TestWithSessionConn_Pool(t *testing.T) {
+	pool, err := pgxpool.New(context.Background(), "postgres://u:p@127.0.0.1:1/db?connect_timeout=1")
+	if err != nil {
+		t.Fatalf("pgxpool.New: %v", err)
+	}
+	defer pool.Close()
+
+	called := false
+	err = withSessionConn(context.Background(), pool, func(dbConn) error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, ErrConnectFailed) || called {
+		t.Fatalf("expected ErrConnectFailed without calling fn, got %v (called=%v)", err, called)
+	}
+}
@@ -0,0 +1,189 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// dbObject is a droppable schema object found by listing a catalog.
+type dbObject struct {
+	Kind   string // SQL object type used in DROP, e.g. "TABLE" or "MATERIALIZED VIEW"
+	Schema string
+	Name   string
+	Args   string // parenthesized identity arguments for routines, otherwise ""
+}
+
+// dropSQL returns the statement that drops o and everything depending on it.
+func (o dbObject) dropSQL() string {
+	return "DROP " + o.Kind + " IF EXISTS " + pgx.Identifier{o.Schema, o.Name}.Sanitize() + o.Args + " CASCADE"
+}
+
+// objectCategory is a class of objects a reset can clear. listSQL takes the
+// schema name as $1 and returns (kind, schema, name, args) rows.
+type objectCategory struct {
+	name    string
+	enabled func(ResetOptions) bool
+	listSQL string
+}
+
+// tableCategory lists ordinary and partitioned tables.
+var tableCategory = objectCategory{
+	name:    "tables",
+	enabled: func(ResetOptions) bool { return true },
+	listSQL: `SELECT 'TABLE', schemaname, tablename, '' FROM pg_tables WHERE schemaname = $1 ORDER BY tablename`,
+}
+
+// objectCategories are dropped in this order. Dependents come before the
+// objects they depend on, though CASCADE makes the order a courtesy rather
+// than a requirement.
+var objectCategories = []objectCategory{
+	{
+		name:    "views",
+		enabled: func(o ResetOptions) bool { return o.DropViews },
+		listSQL: `SELECT 'VIEW', schemaname, viewname, '' FROM pg_views WHERE schemaname = $1 ORDER BY viewname`,
+	},
+	{
+		name:    "materialized views",
+		enabled: func(o ResetOptions) bool { return o.DropMaterializedViews },
+		listSQL: `SELECT 'MATERIALIZED VIEW', schemaname, matviewname, '' FROM pg_matviews WHERE schemaname = $1 ORDER BY matviewname`,
+	},
+	tableCategory,
+	{
+		name:    "sequences",
+		enabled: func(o ResetOptions) bool { return o.DropSequences },
+		listSQL: `SELECT 'SEQUENCE', schemaname, sequencename, '' FROM pg_sequences WHERE schemaname = $1 ORDER BY sequencename`,
+	},
+	{
+		name:    "functions",
+		enabled: func(o ResetOptions) bool { return o.DropFunctions },
+		listSQL: `
+SELECT CASE p.prokind WHEN 'p' THEN 'PROCEDURE' WHEN 'a' THEN 'AGGREGATE' ELSE 'FUNCTION' END,
+       n.nspname, p.proname, '(' || pg_get_function_identity_arguments(p.oid) || ')'
+FROM pg_proc p
+JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE n.nspname = $1
+  AND NOT EXISTS (
+    SELECT 1 FROM pg_depend d
+    WHERE d.classid = 'pg_proc'::regclass AND d.objid = p.oid AND d.deptype = 'e'
+  )
+ORDER BY p.proname`,
+	},
+	{
+		name:    "types",
+		enabled: func(o ResetOptions) bool { return o.DropTypes },
+		listSQL: `
+SELECT CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END,
+       n.nspname, t.typname, ''
+FROM pg_type t
+JOIN pg_namespace n ON n.oid = t.typnamespace
+LEFT JOIN pg_class c ON c.oid = t.typrelid
+WHERE n.nspname = $1
+  AND t.typtype IN ('c', 'd', 'e', 'r')
+  AND (t.typrelid = 0 OR c.relkind = 'c')
+  AND NOT EXISTS (
+    SELECT 1 FROM pg_depend d
+    WHERE d.classid = 'pg_type'::regclass AND d.objid = t.oid AND d.deptype = 'e'
+  )
+ORDER BY t.typname`,
+	},
+}
+
+// listObjects returns the objects of category cat in schema.
+func listObjects(ctx context.Context, conn dbConn, cat objectCategory, schema string) ([]dbObject, error) {
+	rows, err := conn.Query(ctx, cat.listSQL, schema)
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", cat.name, err)
+	}
+	objs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (dbObject, error) {
+		var o dbObject
+		err := row.Scan(&o.Kind, &o.Schema, &o.Name, &o.Args)
+		return o, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", cat.name, err)
+	}
+	return objs, nil
+}
+
+// objectsToDrop lists every object that opts asks a reset to drop, schema by
+// schema, in drop order.
+func objectsToDrop(ctx context.Context, conn dbConn, opts ResetOptions) ([]dbObject, error) {
+	var all []dbObject
+	for _, schema := range opts.schemas() {
+		for _, cat := range objectCategories {
+			if !cat.enabled(opts) {
+				continue
+			}
+			objs, err := listObjects(ctx, conn, cat, schema)
+			if err != nil {
+				return nil, err
+			}
+			for _, o := range objs {
+				if o.Kind == "TABLE" && opts.excludes(o.Schema, o.Name) {
+					continue
+				}
+				all = append(all, o)
+			}
+		}
+	}
+	return all, nil
+}
+
+// dropObjects drops each object in turn and returns those it dropped. IF
+// EXISTS already turns an object removed concurrently since it was listed
+// into a notice; with skipMissing, an error saying it no longer exists is
+// skipped as well. That must stay off inside a transaction, which the error
+// has already aborted.
+func dropObjects(ctx context.Context, conn dbConn, objs []dbObject, skipMissing bool) ([]dbObject, error) {
+	dropped := make([]dbObject, 0, len(objs))
+	for _, o := range objs {
+		if _, err := conn.Exec(ctx, o.dropSQL()); err != nil {
+			if skipMissing && isMissingObject(err) {
+				continue
+			}
+			return dropped, fmt.Errorf("drop %s %s: %w", o.Kind, pgx.Identifier{o.Schema, o.Name}.Sanitize(), err)
+		}
+		dropped = append(dropped, o)
+	}
+	return dropped, nil
+}
+
+// isMissingObject reports whether err says the object, or its schema, does
+// not exist.
+func isMissingObject(err error) bool {
+	switch pgErrCode(err) {
+	case pgUndefinedTable, pgUndefinedObject, pgInvalidSchemaName:
+		return true
+	}
+	return false
+}
+
+// tableNames returns the names of the tables among objs. Tables outside the
+// public schema are qualified as schema.table.
+func tableNames(objs []dbObject) []string {
+	var names []string
+	for _, o := range objs {
+		if o.Kind != "TABLE" {
+			continue
+		}
+		if o.Schema == "public" {
+			names = append(names, o.Name)
+		} else {
+			names = append(names, o.Schema+"."+o.Name)
+		}
+	}
+	return names
+}
+
+// auditNames returns objs as kind and schema-qualified name, e.g.
+// "table public.users", for AuditEvent.Objects.
+func auditNames(objs []dbObject) []string {
+	names := make([]string, len(objs))
+	for i, o := range objs {
+		names[i] = strings.ToLower(o.Kind) + " " + o.Schema + "." + o.Name + o.Args
+	}
+	return names
+}
@@ -0,0 +1,707 @@
+package psqltoolbox
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DumpFormat selects the pg_dump output format.
+type DumpFormat string
+
+const (
+	// DumpFormatCustom is pg_dump's compressed custom archive (-F c). It is the
+	// default when no format is set.
+	DumpFormatCustom DumpFormat = "custom"
+	// DumpFormatPlain is a plain-text SQL script (-F p).
+	DumpFormatPlain DumpFormat = "plain"
+	// DumpFormatDirectory is a directory archive (-F d). The output path is
+	// treated as a directory, which pg_dump creates.
+	DumpFormatDirectory DumpFormat = "directory"
+	// DumpFormatTar is a tar archive (-F t).
+	DumpFormatTar DumpFormat = "tar"
+)
+
+// flag returns the single-letter value passed to pg_dump's -F flag.
+func (f DumpFormat) flag() (string, error) {
+	switch f {
+	case "", DumpFormatCustom:
+		return "c", nil
+	case DumpFormatPlain:
+		return "p", nil
+	case DumpFormatDirectory:
+		return "d", nil
+	case DumpFormatTar:
+		return "t", nil
+	default:
+		return "", fmt.Errorf("unsupported dump format %q", string(f))
+	}
+}
+
+// CompressionMethod is a compression method for pg_dump's --compress flag.
+type CompressionMethod string
+
+const (
+	// CompressionGzip is the method pg_dump has always used.
+	CompressionGzip CompressionMethod = "gzip"
+	// CompressionLZ4 is faster than gzip; it needs pg_dump 16 or later.
+	CompressionLZ4 CompressionMethod = "lz4"
+	// CompressionZstd compresses better and faster than gzip; it needs
+	// pg_dump 16 or later.
+	CompressionZstd CompressionMethod = "zstd"
+	// CompressionNone turns compression off, including the custom format's
+	// default gzip.
+	CompressionNone CompressionMethod = "none"
+)
+
+// maxLevel returns the highest compression level pg_dump accepts for m, or
+// -1 if m is not a method pg_dump supports.
+func (m CompressionMethod) maxLevel() int {
+	switch m {
+	case "", CompressionGzip:
+		return 9
+	case CompressionLZ4:
+		return 12
+	case CompressionZstd:
+		return 22
+	case CompressionNone:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// PgDumpOptions controls how PgDumpToFileWithOptions invokes pg_dump.
+// The zero value produces a custom-format dump, matching PgDumpToFile.
+type PgDumpOptions struct {
+	// Binary is the path to the pg_dump executable, e.g.
+	// /usr/lib/postgresql/16/bin/pg_dump. When empty, pg_dump is resolved
+	// from PATH.
+	Binary string
+
+	// Runner runs pg_dump; defaults to ExecRunner. A custom Runner is given
+	// Binary, or "pg_dump", without looking it up in PATH.
+	Runner CommandRunner
+
+	// PasswordOptional accepts a dbURL without a password; pg_dump then
+	// authenticates through ~/.pgpass or an inherited PGPASSWORD.
+	PasswordOptional bool
+
+	// ExtraEnv sets additional environment variables for pg_dump, such as
+	// PGSSLCERT and PGSSLKEY for client certificate authentication. They
+	// override values derived from dbURL, including PGSSLMODE from its
+	// sslmode parameter.
+	ExtraEnv map[string]string
+
+	// Snapshot runs the dump in a snapshot exported by ExportSnapshot
+	// (--snapshot), so several dumps of the same database see the same
+	// data. The Snapshot must stay open until pg_dump has started.
+	Snapshot string
+
+	// ExtraArgs are passed to pg_dump verbatim, after the arguments built
+	// from the other options and before -f, for flags without an option of
+	// their own such as --no-owner. They are not validated, so
+	// a flag that conflicts with the generated ones is left to pg_dump.
+	ExtraArgs []string
+
+	// Format selects the output format; defaults to DumpFormatCustom, or to
+	// DumpFormatDirectory when Jobs is greater than one.
+	Format DumpFormat
+
+	// Compression is a compression level from 1 to 9; zero leaves the
+	// format's default. Plain-format output is gzipped in-process, so outFile
+	// should end in .sql.gz. Custom and directory formats pass the level to
+	// pg_dump's -Z instead. Tar archives cannot be compressed.
+	Compression int
+	// CompressionMethod has pg_dump compress with the given method through
+	// --compress=method:level, with Compression as the level, zero meaning
+	// the method's default: up to 9 for gzip, 12 for lz4 and 22 for zstd.
+	// Plain-format output is then compressed by pg_dump too. Before running
+	// the dump, pg_dump's version is checked: older than 16, gzip and none
+	// fall back to -Z and lz4 and zstd are rejected.
+	CompressionMethod CompressionMethod
+	// numericCompress is set for a pg_dump older than 16, which only
+	// accepts a level in -Z.
+	numericCompress bool
+
+	// Jobs dumps this many tables in parallel (-j). Values above one require
+	// the directory format, and the output path must be a directory.
+	Jobs int
+
+	// SchemaOnly dumps only object definitions (--schema-only).
+	SchemaOnly bool
+	// DataOnly dumps only table data (--data-only). It cannot be combined
+	// with SchemaOnly.
+	DataOnly bool
+
+	// IncludeTables limits the dump to tables matching these patterns (-t).
+	// Patterns are passed through verbatim, so pg_dump globs like audit_* work.
+	IncludeTables []string
+	// ExcludeTables omits tables matching these patterns (-T).
+	ExcludeTables []string
+
+	// IncludeSchemas limits the dump to schemas matching these patterns
+	// (-n), e.g. a single tenant's schema. Like the table patterns they are
+	// passed through verbatim.
+	IncludeSchemas []string
+	// ExcludeSchemas omits schemas matching these patterns (-N).
+	ExcludeSchemas []string
+
+	// WriteMetadata writes a DumpMetadata JSON sidecar to outFile +
+	// ".meta.json" after a successful dump. It needs an output file, so it
+	// is rejected by PgDumpToWriterWithOptions. A sidecar that cannot be
+	// written, e.g. because the server cannot be asked for its version,
+	// fails the call with ErrMetadataFailed but leaves the dump in place.
+	WriteMetadata bool
+
+	// Checksum, when set, is called after a successful dump with the
+	// hex-encoded SHA-256 of the output, matching what sha256sum prints for
+	// the file. A streamed dump is hashed as it is written. The directory
+	// format has no single output to hash and is rejected.
+	Checksum func(sum string)
+	// WriteChecksum writes the SHA-256 of outFile to outFile + ".sha256" in
+	// sha256sum's format. Like WriteMetadata it needs an output file, and
+	// like Checksum it is rejected for the directory format.
+	WriteChecksum bool
+
+	// Quiet leaves out pg_dump's -v, so stderr only carries warnings and
+	// errors rather than a message per object dumped. Progress then sees
+	// those alone.
+	Quiet bool
+
+	// Progress, when set, is called with each line pg_dump writes to stderr,
+	// which with -v includes a message per object dumped. Calls come from a
+	// single goroutine and end before the dump function returns. The lines
+	// are not also forwarded to os.Stderr unless TeeStderr is set.
+	Progress func(line string)
+	// TeeStderr forwards pg_dump's stderr to os.Stderr even when Progress is
+	// set.
+	TeeStderr bool
+
+	// OutFileTemplate treats the output path given to PgDumpToFileWithOptions
+	// or PgDumpToFileWithResult as a ResolveDumpPath template, expanded with
+	// the database name from dbURL and the time the dump starts. Use
+	// PgDumpToFileWithResult to learn the resulting path.
+	OutFileTemplate bool
+
+	// ErrorTailLines is how many trailing stderr lines a failed dump's
+	// CommandError carries in Stderr and its message; defaults to 20. Up to
+	// 4 MiB of stderr remains available from CommandError.FullStderr.
+	ErrorTailLines int
+}
+
+// stderr returns where pg_dump's stderr should go, nil meaning os.Stderr, and
+// a func to call once pg_dump has exited to flush any partial last line.
+func (o PgDumpOptions) stderr() (io.Writer, func()) {
+	if o.Progress == nil {
+		return nil, func() {}
+	}
+	lw := &lineWriter{fn: o.Progress}
+	if o.TeeStderr {
+		return io.MultiWriter(os.Stderr, lw), lw.flush
+	}
+	return lw, lw.flush
+}
+
+// format returns the effective output format.
+func (o PgDumpOptions) format() DumpFormat {
+	if o.Format == "" && o.Jobs > 1 {
+		return DumpFormatDirectory
+	}
+	return o.Format
+}
+
+// gzipsOutput reports whether pg_dump's output is gzipped in-process rather
+// than compressed by pg_dump itself.
+func (o PgDumpOptions) gzipsOutput() bool {
+	return o.Compression > 0 && o.CompressionMethod == "" && o.format() == DumpFormatPlain
+}
+
+// validate reports option combinations pg_dump would reject.
+func (o PgDumpOptions) validate() error {
+	if o.Jobs < 0 {
+		return fmt.Errorf("Jobs must not be negative, got %d", o.Jobs)
+	}
+	if o.Jobs > 1 && o.format() != DumpFormatDirectory {
+		return fmt.Errorf("parallel dumps (Jobs=%d) require directory format, got %q", o.Jobs, o.Format)
+	}
+	maxLevel := o.CompressionMethod.maxLevel()
+	if maxLevel < 0 {
+		return fmt.Errorf("unsupported CompressionMethod %q; pg_dump supports gzip, lz4, zstd and none", string(o.CompressionMethod))
+	}
+	if o.Compression < 0 || o.Compression > maxLevel {
+		if o.CompressionMethod == CompressionNone {
+			return fmt.Errorf("CompressionMethod none takes no Compression level, got %d", o.Compression)
+		}
+		return fmt.Errorf("Compression must be between 0 and %d, got %d", maxLevel, o.Compression)
+	}
+	compresses := o.Compression > 0 || (o.CompressionMethod != "" && o.CompressionMethod != CompressionNone)
+	if compresses && o.format() == DumpFormatTar {
+		return fmt.Errorf("tar format does not support compression")
+	}
+	if o.SchemaOnly && o.DataOnly {
+		return fmt.Errorf("SchemaOnly and DataOnly are mutually exclusive")
+	}
+	for _, p := range o.IncludeTables {
+		if slices.Contains(o.ExcludeTables, p) {
+			return fmt.Errorf("table pattern %q is both included and excluded", p)
+		}
+	}
+	for _, p := range o.IncludeSchemas {
+		if slices.Contains(o.ExcludeSchemas, p) {
+			return fmt.Errorf("schema pattern %q is both included and excluded", p)
+		}
+	}
+	return nil
+}
+
+// compressArgs returns pg_dump's compression flag, if any.
+func (o PgDumpOptions) compressArgs() []string {
+	switch {
+	case o.CompressionMethod == "":
+		if o.Compression > 0 && !o.gzipsOutput() {
+			return []string{"-Z", strconv.Itoa(o.Compression)}
+		}
+		return nil
+	case o.numericCompress && o.CompressionMethod == CompressionNone:
+		return []string{"-Z", "0"}
+	case o.numericCompress:
+		level := o.Compression
+		if level == 0 {
+			level = 6 // zlib's default, which --compress=gzip uses too
+		}
+		return []string{"-Z", strconv.Itoa(level)}
+	case o.Compression > 0:
+		return []string{"--compress=" + string(o.CompressionMethod) + ":" + strconv.Itoa(o.Compression)}
+	default:
+		return []string{"--compress=" + string(o.CompressionMethod)}
+	}
+}
+
+// checkCompressSupport asks pg_dump for its version when opts sets a
+// CompressionMethod and returns opts adjusted for a pg_dump older than 16,
+// which predates --compress=method.
+func checkCompressSupport(ctx context.Context, opts PgDumpOptions) (PgDumpOptions, error) {
+	if opts.CompressionMethod == "" {
+		return opts, nil
+	}
+	if err := opts.validate(); err != nil {
+		return opts, fmt.Errorf("pg_dump options: %w", err)
+	}
+	bin, err := toolBinary(opts.Runner, opts.Binary, "pg_dump", ErrDumpFailed)
+	if err != nil {
+		return opts, err
+	}
+	raw, err := pgDumpVersion(ctx, opts.Runner, bin)
+	if err != nil {
+		return opts, fmt.Errorf("pg_dump options: CompressionMethod: %w", err)
+	}
+	v, err := parsePGVersion(raw)
+	if err != nil {
+		return opts, fmt.Errorf("pg_dump options: CompressionMethod: parse pg_dump version: %w", err)
+	}
+	if v.Major >= 16 {
+		return opts, nil
+	}
+	if opts.CompressionMethod == CompressionLZ4 || opts.CompressionMethod == CompressionZstd {
+		return opts, fmt.Errorf("pg_dump options: CompressionMethod %s needs pg_dump 16 or later, got %s", opts.CompressionMethod, v.Raw)
+	}
+	opts.numericCompress = true
+	return opts, nil
+}
+
+// args builds the pg_dump argument list for cfg writing to outFile, or to
+// stdout when outFile is empty.
+func (o PgDumpOptions) args(cfg *ConnConfig, outFile string) ([]string, error) {
+	if err := o.validate(); err != nil {
+		return nil, err
+	}
+	if outFile == "" && o.format() == DumpFormatDirectory {
+		return nil, fmt.Errorf("directory format cannot be written to a stream")
+	}
+	format, err := o.format().flag()
+	if err != nil {
+		return nil, err
+	}
+	if o.Jobs > 1 {
+		if fi, err := os.Stat(outFile); err == nil && !fi.IsDir() {
+			return nil, fmt.Errorf("parallel dumps write a directory, but %s is a file", outFile)
+		}
+	}
+	args := []string{
+		"-h", cfg.Host,
+		"-p", cfg.Port,
+		"-U", cfg.User,
+		"-d", cfg.Database,
+		"-F", format,
+		"-b",
+	}
+	if !o.Quiet {
+		args = append(args, "-v")
+	}
+	args = append(args, o.compressArgs()...)
+	if o.Jobs > 1 {
+		args = append(args, "-j", strconv.Itoa(o.Jobs))
+	}
+	if o.SchemaOnly {
+		args = append(args, "--schema-only")
+	}
+	if o.DataOnly {
+		args = append(args, "--data-only")
+	}
+	for _, p := range o.IncludeSchemas {
+		args = append(args, "-n", p)
+	}
+	for _, p := range o.ExcludeSchemas {
+		args = append(args, "-N", p)
+	}
+	for _, p := range o.IncludeTables {
+		args = append(args, "-t", p)
+	}
+	for _, p := range o.ExcludeTables {
+		args = append(args, "-T", p)
+	}
+	if o.Snapshot != "" {
+		args = append(args, "--snapshot="+o.Snapshot)
+	}
+	args = append(args, o.ExtraArgs...)
+	if outFile != "" {
+		args = append(args, "-f", outFile)
+	}
+	return args, nil
+}
+
+// PgDumpToFile runs pg_dump for the database described by dbURL and writes the
+// dump to outFile. A timeout is applied by deriving a child context from parentCtx.
+func PgDumpToFile(parentCtx context.Context, dbURL, outFile string, timeout time.Duration) error {
+	return PgDumpToFileWithOptions(parentCtx, dbURL, outFile, timeout, PgDumpOptions{})
+}
+
+// PgDumpToFileWithOptions is like PgDumpToFile but lets the caller control the
+// pg_dump invocation through opts. For DumpFormatDirectory, outFile is the
+// directory to write the archive into.
+func PgDumpToFileWithOptions(parentCtx context.Context, dbURL, outFile string, timeout time.Duration, opts PgDumpOptions) error {
+	outFile, err := resolveOutFile(dbURL, outFile, opts)
+	if err != nil {
+		return err
+	}
+	_, err = pgDump(parentCtx, dbURL, timeout, opts, outFile, nil, pgxConnect)
+	return err
+}
+
+// DumpResult summarizes a dump written by PgDumpToFileWithResult.
+type DumpResult struct {
+	// OutputPath is the dump file, or directory for DumpFormatDirectory,
+	// after expanding it as a template with PgDumpOptions.OutFileTemplate.
+	OutputPath string
+	// Bytes is the size of the dump file, or the total size of the files
+	// in a directory-format dump.
+	Bytes int64
+	// Duration is how long pg_dump ran, excluding checksums and metadata.
+	Duration time.Duration
+	// Format is the format the dump was written in.
+	Format DumpFormat
+}
+
+// PgDumpToFileWithResult is like PgDumpToFileWithOptions but also reports the
+// size of the dump and how long it took, e.g. for backup logs.
+func PgDumpToFileWithResult(parentCtx context.Context, dbURL, outFile string, timeout time.Duration, opts PgDumpOptions) (*DumpResult, error) {
+	outFile, err := resolveOutFile(dbURL, outFile, opts)
+	if err != nil {
+		return nil, err
+	}
+	elapsed, err := pgDump(parentCtx, dbURL, timeout, opts, outFile, nil, pgxConnect)
+	if err != nil {
+		return nil, err
+	}
+	size, err := dumpSize(outFile)
+	if err != nil {
+		return nil, fmt.Errorf("dump result: %w", err)
+	}
+	format := opts.format()
+	if format == "" {
+		format = DumpFormatCustom
+	}
+	return &DumpResult{OutputPath: outFile, Bytes: size, Duration: elapsed, Format: format}, nil
+}
+
+// PgDumpToWriter runs pg_dump for the database described by dbURL and streams
+// the custom-format dump to w, e.g. an upload to object storage, without a
+// temporary file. pg_dump's diagnostics go to stderr and never into w.
+func PgDumpToWriter(ctx context.Context, dbURL string, w io.Writer, timeout time.Duration) error {
+	return PgDumpToWriterWithOptions(ctx, dbURL, w, timeout, PgDumpOptions{})
+}
+
+// PgDumpToWriterWithOptions is like PgDumpToWriter but lets the caller control
+// the pg_dump invocation through opts. The directory format and parallel
+// jobs need a filesystem target and are rejected.
+func PgDumpToWriterWithOptions(ctx context.Context, dbURL string, w io.Writer, timeout time.Duration, opts PgDumpOptions) error {
+	if w == nil {
+		return fmt.Errorf("pg_dump options: nil writer")
+	}
+	_, err := pgDump(ctx, dbURL, timeout, opts, "", w, pgxConnect)
+	return err
+}
+
+// pgDump runs pg_dump writing to outFile, or to stdout when outFile is empty,
+// then writes the metadata sidecar if requested. connect is used to ask the
+// server for its version. It returns how long pg_dump itself ran.
+func pgDump(parentCtx context.Context, dbURL string, timeout time.Duration, opts PgDumpOptions, outFile string, stdout io.Writer, connect connector) (time.Duration, error) {
+	cfg, err := ParseConnConfigWithOptions(dbURL, ParseOptions{PasswordOptional: opts.PasswordOptional})
+	if err != nil {
+		return 0, fmt.Errorf("parse db url: %w", err)
+	}
+	if opts.WriteMetadata && outFile == "" {
+		return 0, fmt.Errorf("pg_dump options: WriteMetadata needs an output file")
+	}
+	if opts.WriteChecksum && outFile == "" {
+		return 0, fmt.Errorf("pg_dump options: WriteChecksum needs an output file")
+	}
+	if (opts.WriteChecksum || opts.Checksum != nil) && opts.format() == DumpFormatDirectory {
+		return 0, fmt.Errorf("pg_dump options: directory-format dumps cannot be checksummed")
+	}
+
+	opts, err = checkCompressSupport(parentCtx, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	// a stream is hashed on the way through; a file is read back afterwards
+	var h hash.Hash
+	if stdout != nil && opts.Checksum != nil {
+		h = sha256.New()
+		stdout = io.MultiWriter(stdout, h)
+	}
+
+	start := time.Now()
+	if opts.gzipsOutput() {
+		err = pgDumpGzip(parentCtx, cfg, timeout, opts, outFile, stdout)
+	} else {
+		err = pgDumpRun(parentCtx, cfg, timeout, opts, outFile, stdout)
+	}
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+
+	if h != nil {
+		opts.Checksum(hex.EncodeToString(h.Sum(nil)))
+	} else if outFile != "" && (opts.Checksum != nil || opts.WriteChecksum) {
+		sum, err := fileSHA256(outFile)
+		if err != nil {
+			return 0, fmt.Errorf("dump checksum: %w", err)
+		}
+		if opts.WriteChecksum {
+			if err := writeChecksumFile(outFile, sum); err != nil {
+				return 0, fmt.Errorf("dump checksum: %w", err)
+			}
+		}
+		if opts.Checksum != nil {
+			opts.Checksum(sum)
+		}
+	}
+
+	if opts.WriteMetadata {
+		if err := writeDumpMetadata(parentCtx, dbURL, cfg, opts, outFile, start, connect); err != nil {
+			return elapsed, err
+		}
+	}
+	return elapsed, nil
+}
+
+// pgDumpRun runs pg_dump writing to outFile, or to stdout when outFile is
+// empty.
+func pgDumpRun(parentCtx context.Context, cfg *ConnConfig, timeout time.Duration, opts PgDumpOptions, outFile string, stdout io.Writer) error {
+	args, err := opts.args(cfg, outFile)
+	if err != nil {
+		return fmt.Errorf("pg_dump options: %w", err)
+	}
+	bin, err := toolBinary(opts.Runner, opts.Binary, "pg_dump", ErrDumpFailed)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	stderr, flush := opts.stderr()
+	err = runTool(ctx, toolCommand{
+		runner: opts.Runner,
+		bin:    bin,
+		args:   args,
+		// pass PGPASSWORD and connection params such as sslmode in env for pg_dump
+		env:       cfg.toolEnv(opts.ExtraEnv),
+		stdout:    stdout,
+		stderr:    stderr,
+		tailLines: opts.ErrorTailLines,
+	}, "pg_dump", ErrDumpFailed)
+	flush()
+	return err
+}
+
+// pgDumpGzip runs a plain-format pg_dump with its output gzipped into outFile,
+// or into stdout when outFile is empty. A partially written outFile is removed
+// on failure.
+func pgDumpGzip(parentCtx context.Context, cfg *ConnConfig, timeout time.Duration, opts PgDumpOptions, outFile string, stdout io.Writer) (err error) {
+	args, err := opts.args(cfg, "")
+	if err != nil {
+		return fmt.Errorf("pg_dump options: %w", err)
+	}
+	bin, err := toolBinary(opts.Runner, opts.Binary, "pg_dump", ErrDumpFailed)
+	if err != nil {
+		return err
+	}
+
+	if outFile != "" {
+		var f *os.File
+		f, err = os.Create(outFile)
+		if err != nil {
+			return fmt.Errorf("create dump file: %w", err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("close dump file: %w", cerr)
+			}
+			if err != nil {
+				os.Remove(outFile)
+			}
+		}()
+		stdout = f
+	}
+	gz, err := gzip.NewWriterLevel(stdout, opts.Compression)
+	if err != nil {
+		return fmt.Errorf("pg_dump options: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	stderr, flush := opts.stderr()
+	err = runTool(ctx, toolCommand{
+		runner:    opts.Runner,
+		bin:       bin,
+		args:      args,
+		env:       cfg.toolEnv(opts.ExtraEnv),
+		stdout:    gz,
+		stderr:    stderr,
+		tailLines: opts.ErrorTailLines,
+	}, "pg_dump", ErrDumpFailed)
+	flush()
+	if err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("gzip dump: %w", err)
+	}
+	return nil
+}
+
+// PgRestoreOptions controls how PgRestoreFromFileWithOptions invokes pg_restore.
+// The zero value matches PgRestoreFromFile.
+type PgRestoreOptions struct {
+	// Binary is the path to the pg_restore executable. When empty,
+	// pg_restore is resolved from PATH.
+	Binary string
+
+	// PasswordOptional accepts a dbURL without a password; pg_restore then
+	// authenticates through ~/.pgpass or an inherited PGPASSWORD.
+	PasswordOptional bool
+
+	// ExtraEnv sets additional environment variables for pg_restore, as for
+	// PgDumpOptions.ExtraEnv.
+	ExtraEnv map[string]string
+
+	// NoOwner skips restoring object ownership (--no-owner), so objects are
+	// owned by the connecting user. Use it when the dump's roles do not
+	// exist in the target environment.
+	NoOwner bool
+	// NoACL skips restoring GRANT and REVOKE privileges (--no-acl).
+	NoACL bool
+	// SingleTransaction restores in one transaction (--single-transaction),
+	// so a failed restore leaves the database untouched.
+	SingleTransaction bool
+}
+
+// args builds the pg_restore argument list for cfg reading inFile, or stdin
+// when inFile is empty.
+func (o PgRestoreOptions) args(cfg *ConnConfig, inFile string) []string {
+	args := []string{
+		"-h", cfg.Host,
+		"-p", cfg.Port,
+		"-U", cfg.User,
+		"-d", cfg.Database,
+		"--clean",
+		"--if-exists",
+		"-v",
+	}
+	if o.NoOwner {
+		args = append(args, "--no-owner")
+	}
+	if o.NoACL {
+		args = append(args, "--no-acl")
+	}
+	if o.SingleTransaction {
+		args = append(args, "--single-transaction")
+	}
+	if inFile != "" {
+		args = append(args, inFile)
+	}
+	return args
+}
+
+// PgRestoreFromFile runs pg_restore to load the dump in inFile into the
+// database described by dbURL. Existing objects are dropped before being
+// recreated (--clean --if-exists) so restoring over a populated database works.
+// A timeout is applied by deriving a child context from parentCtx.
+func PgRestoreFromFile(parentCtx context.Context, dbURL, inFile string, timeout time.Duration) error {
+	return PgRestoreFromFileWithOptions(parentCtx, dbURL, inFile, timeout, PgRestoreOptions{})
+}
+
+// PgRestoreFromFileWithOptions is like PgRestoreFromFile but lets the caller
+// control the pg_restore invocation through opts.
+func PgRestoreFromFileWithOptions(parentCtx context.Context, dbURL, inFile string, timeout time.Duration, opts PgRestoreOptions) error {
+	return pgRestore(parentCtx, dbURL, inFile, nil, timeout, opts)
+}
+
+// PgRestoreFromReader is like PgRestoreFromFile but streams a custom-format
+// dump from r into pg_restore's stdin, e.g. a download from object storage,
+// without a temporary file. Directory-format dumps cannot be streamed.
+func PgRestoreFromReader(ctx context.Context, dbURL string, r io.Reader, timeout time.Duration) error {
+	return PgRestoreFromReaderWithOptions(ctx, dbURL, r, timeout, PgRestoreOptions{})
+}
+
+// PgRestoreFromReaderWithOptions is like PgRestoreFromReader but lets the
+// caller control the pg_restore invocation through opts.
+func PgRestoreFromReaderWithOptions(ctx context.Context, dbURL string, r io.Reader, timeout time.Duration, opts PgRestoreOptions) error {
+	if r == nil {
+		return fmt.Errorf("%w: nil reader", ErrRestoreFailed)
+	}
+	return pgRestore(ctx, dbURL, "", r, timeout, opts)
+}
+
+// pgRestore runs pg_restore reading inFile, or stdin when inFile is empty.
+func pgRestore(parentCtx context.Context, dbURL, inFile string, stdin io.Reader, timeout time.Duration, opts PgRestoreOptions) error {
+	cfg, err := ParseConnConfigWithOptions(dbURL, ParseOptions{PasswordOptional: opts.PasswordOptional})
+	if err != nil {
+		return fmt.Errorf("parse db url: %w", err)
+	}
+
+	bin, err := lookupBinary(opts.Binary, "pg_restore", ErrRestoreFailed)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	// pass PGPASSWORD and connection params such as sslmode in env for pg_restore
+	return runTool(ctx, toolCommand{bin: bin, args: opts.args(cfg, inFile), env: cfg.toolEnv(opts.ExtraEnv), stdin: stdin}, "pg_restore", ErrRestoreFailed)
+}
@@ -0,0 +1,803 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeArgsRecorder writes a fake executable called name into a new temp dir
+// that records its arguments, one per line, into the returned args file.
+func writeArgsRecorder(t *testing.T, name string) (dir, argsFile string) {
+	t.Helper()
+	dir = t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" > "` + argsFile + `"
+exit 0
+`
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake %s: %v", name, err)
+	}
+	return dir, argsFile
+}
+
+// readArgs returns the arguments recorded by writeArgsRecorder.
+func readArgs(t *testing.T, argsFile string) []string {
+	t.Helper()
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read args file: %v", err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+// flagValue returns the value following the first occurrence of flag in args.
+func flagValue(args []string, flag string) (string, bool) {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+func TestPgDumpToFileWithOptions_Format(t *testing.T) {
+	cases := map[DumpFormat]string{
+		"":                  "c",
+		DumpFormatCustom:    "c",
+		DumpFormatPlain:     "p",
+		DumpFormatDirectory: "d",
+		DumpFormatTar:       "t",
+	}
+	for format, want := range cases {
+		dir, argsFile := writeArgsRecorder(t, "pg_dump")
+		withPathPrepended(dir, func() {
+			outFile := filepath.Join(t.TempDir(), "backup")
+			err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, PgDumpOptions{Format: format})
+			if err != nil {
+				t.Fatalf("format %q: %v", format, err)
+			}
+			got, _ := flagValue(readArgs(t, argsFile), "-F")
+			if got != want {
+				t.Fatalf("format %q: expected -F %s, got %q", format, want, got)
+			}
+		})
+	}
+}
+
+func TestPgDumpToFileWithOptions_UnsupportedFormat(t *testing.T) {
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, PgDumpOptions{Format: "zip"})
+	if err == nil || !strings.Contains(err.Error(), `unsupported dump format "zip"`) {
+		t.Fatalf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestPgDumpToFileWithOptions_SchemaOrDataOnly(t *testing.T) {
+	cases := []struct {
+		opts PgDumpOptions
+		flag string
+	}{
+		{PgDumpOptions{SchemaOnly: true}, "--schema-only"},
+		{PgDumpOptions{DataOnly: true}, "--data-only"},
+	}
+	for _, c := range cases {
+		dir, argsFile := writeArgsRecorder(t, "pg_dump")
+		withPathPrepended(dir, func() {
+			outFile := filepath.Join(t.TempDir(), "backup.dump")
+			if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, c.opts); err != nil {
+				t.Fatalf("%s: %v", c.flag, err)
+			}
+			if !slices.Contains(readArgs(t, argsFile), c.flag) {
+				t.Fatalf("expected %s in pg_dump args", c.flag)
+			}
+		})
+	}
+}
+
+func TestPgDumpToFileWithOptions_SchemaAndDataOnly(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "pg_dump")
+	withPathPrepended(dir, func() {
+		err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, PgDumpOptions{SchemaOnly: true, DataOnly: true})
+		if err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+		if _, statErr := os.Stat(argsFile); statErr == nil {
+			t.Fatalf("expected pg_dump not to be executed")
+		}
+	})
+}
+
+func TestPgDumpOptions_TableArgs(t *testing.T) {
+	cfg := &ConnConfig{User: "u", Password: "p", Host: "h", Port: "1234", Database: "db"}
+
+	base, err := PgDumpOptions{}.args(cfg, "out")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	empty, err := PgDumpOptions{IncludeTables: []string{}, ExcludeTables: []string{}}.args(cfg, "out")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(base, empty) {
+		t.Fatalf("empty table slices changed args: %v vs %v", base, empty)
+	}
+
+	args, err := PgDumpOptions{
+		IncludeTables: []string{"users", "orders"},
+		ExcludeTables: []string{"audit_*"},
+	}.args(cfg, "out")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"-h", "h", "-p", "1234", "-U", "u", "-d", "db", "-F", "c", "-b", "-v",
+		"-t", "users", "-t", "orders", "-T", "audit_*",
+		"-f", "out",
+	}
+	if !slices.Equal(args, want) {
+		t.Fatalf("unexpected args:\n got %v\nwant %v", args, want)
+	}
+
+	_, err = PgDumpOptions{IncludeTables: []string{"audit_*"}, ExcludeTables: []string{"audit_*"}}.args(cfg, "out")
+	if err == nil {
+		t.Fatalf("expected error when a pattern is both included and excluded")
+	}
+}
+
+func TestPgDumpOptions_Quiet(t *testing.T) {
+	cfg := &ConnConfig{User: "u", Password: "p", Host: "h", Port: "1234", Database: "db"}
+	for quiet, wantVerbose := range map[bool]bool{false: true, true: false} {
+		args, err := PgDumpOptions{Quiet: quiet}.args(cfg, "out")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if slices.Contains(args, "-v") != wantVerbose {
+			t.Fatalf("Quiet=%v: got args %v, want -v present=%v", quiet, args, wantVerbose)
+		}
+	}
+}
+
+func TestPgDumpOptions_SchemaArgs(t *testing.T) {
+	cfg := &ConnConfig{User: "u", Password: "p", Host: "h", Port: "1234", Database: "db"}
+
+	args, err := PgDumpOptions{
+		IncludeSchemas: []string{"tenant_42"},
+		ExcludeSchemas: []string{"tenant_*_archive", "pg_temp*"},
+		IncludeTables:  []string{"tenant_42.users"},
+	}.args(cfg, "out")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		"-h", "h", "-p", "1234", "-U", "u", "-d", "db", "-F", "c", "-b", "-v",
+		"-n", "tenant_42", "-N", "tenant_*_archive", "-N", "pg_temp*",
+		"-t", "tenant_42.users",
+		"-f", "out",
+	}
+	if !slices.Equal(args, want) {
+		t.Fatalf("unexpected args:\n got %v\nwant %v", args, want)
+	}
+
+	_, err = PgDumpOptions{IncludeSchemas: []string{"tenant_42"}, ExcludeSchemas: []string{"tenant_42"}}.args(cfg, "out")
+	if err == nil {
+		t.Fatalf("expected error when a schema pattern is both included and excluded")
+	}
+}
+
+// Test that ExtraArgs reach pg_dump verbatim, after the generated flags and
+// before -f.
+func TestPgDumpToFileWithOptions_ExtraArgs(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "pg_dump")
+	outFile := filepath.Join(t.TempDir(), "out.dump")
+
+	withPathPrepended(dir, func() {
+		opts := PgDumpOptions{
+			Quiet:         true,
+			ExcludeTables: []string{"audit_*"},
+			ExtraArgs:     []string{"--no-owner", "--snapshot=00000003-0000001B-1"},
+		}
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+	})
+
+	want := []string{
+		"-h", "h", "-p", "1234", "-U", "u", "-d", "db", "-F", "c", "-b",
+		"-T", "audit_*",
+		"--no-owner", "--snapshot=00000003-0000001B-1",
+		"-f", outFile,
+	}
+	if args := readArgs(t, argsFile); !slices.Equal(args, want) {
+		t.Fatalf("unexpected args:\n got %v\nwant %v", args, want)
+	}
+}
+
+// Test that an absolute Binary path is used instead of a PATH lookup.
+func TestPgDumpToFileWithOptions_Binary(t *testing.T) {
+	// the versioned name is not on PATH, so it can only be found by its absolute path
+	dir, argsFile := writeArgsRecorder(t, "pg_dump-16")
+
+	opts := PgDumpOptions{Binary: filepath.Join(dir, "pg_dump-16")}
+	if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts); err != nil {
+		t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+	}
+	if got, _ := flagValue(readArgs(t, argsFile), "-f"); got != "out" {
+		t.Fatalf("expected fake pg_dump to be invoked with -f out, got %q", got)
+	}
+
+	restoreDir, restoreArgs := writeArgsRecorder(t, "pg_restore-16")
+	ropts := PgRestoreOptions{Binary: filepath.Join(restoreDir, "pg_restore-16")}
+	if err := PgRestoreFromFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "in.dump", 5*time.Second, ropts); err != nil {
+		t.Fatalf("PgRestoreFromFileWithOptions failed: %v", err)
+	}
+	if args := readArgs(t, restoreArgs); args[len(args)-1] != "in.dump" {
+		t.Fatalf("expected fake pg_restore to be invoked with in.dump, got %v", args)
+	}
+}
+
+func TestPgRestoreFromFileWithOptions_Flags(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "pg_restore")
+	opts := PgRestoreOptions{NoOwner: true, NoACL: true, SingleTransaction: true}
+	withPathPrepended(dir, func() {
+		if err := PgRestoreFromFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "in.dump", 5*time.Second, opts); err != nil {
+			t.Fatalf("PgRestoreFromFileWithOptions failed: %v", err)
+		}
+	})
+	want := []string{"-h", "h", "-p", "1234", "-U", "u", "-d", "db", "--clean", "--if-exists", "-v", "--no-owner", "--no-acl", "--single-transaction", "in.dump"}
+	if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+		t.Fatalf("got args %v, want %v", got, want)
+	}
+}
+
+// Test that the dump read from r reaches pg_restore's stdin in full, with no
+// input file argument, and that a failure still reports pg_restore's stderr.
+func TestPgRestoreFromReader(t *testing.T) {
+	dir := t.TempDir()
+	lenFile := filepath.Join(dir, "len")
+	script := `#!/usr/bin/env bash
+wc -c | tr -d ' ' > "` + lenFile + `"
+printf '%s\n' "$@" > "` + filepath.Join(dir, "args") + `"
+if [ -n "$FAIL" ]; then echo "pg_restore: error: input file is too short" >&2; exit 1; fi
+`
+	if err := os.WriteFile(filepath.Join(dir, "pg_restore"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_restore: %v", err)
+	}
+	dump := bytes.Repeat([]byte("PGDMP"), 100000)
+	opts := PgRestoreOptions{Binary: filepath.Join(dir, "pg_restore")}
+
+	if err := PgRestoreFromReaderWithOptions(context.Background(), "postgres://u:p@h:1234/db", bytes.NewReader(dump), 5*time.Second, opts); err != nil {
+		t.Fatalf("PgRestoreFromReaderWithOptions failed: %v", err)
+	}
+	if got, err := os.ReadFile(lenFile); err != nil || strings.TrimSpace(string(got)) != strconv.Itoa(len(dump)) {
+		t.Fatalf("expected pg_restore to read %d bytes, got %q (%v)", len(dump), got, err)
+	}
+	if args := readArgs(t, filepath.Join(dir, "args")); args[len(args)-1] != "-v" {
+		t.Fatalf("expected no input file argument, got %v", args)
+	}
+
+	opts.ExtraEnv = map[string]string{"FAIL": "1"}
+	err := PgRestoreFromReaderWithOptions(context.Background(), "postgres://u:p@h:1234/db", bytes.NewReader(dump), 5*time.Second, opts)
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || !errors.Is(err, ErrRestoreFailed) || cmdErr.ExitCode != 1 {
+		t.Fatalf("expected a pg_restore CommandError with exit code 1, got %v", err)
+	}
+	if !strings.Contains(cmdErr.Stderr, "input file is too short") {
+		t.Fatalf("expected pg_restore's stderr in the error, got %q", cmdErr.Stderr)
+	}
+}
+
+// Test that pg_dump's stderr diagnostic is included in the returned error.
+func TestPgDumpToFile_StderrInError(t *testing.T) {
+	tmpdir := t.TempDir()
+	script := `#!/usr/bin/env bash
+echo "pg_dump: dumping contents of table foo" >&2
+echo "pg_dump: error: permission denied for table foo" >&2
+exit 1
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+
+	withPathPrepended(tmpdir, func() {
+		err := PgDumpToFile(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second)
+		if err == nil {
+			t.Fatalf("expected error from failing pg_dump")
+		}
+		if !strings.Contains(err.Error(), "permission denied for table foo") {
+			t.Fatalf("expected stderr message in error, got %v", err)
+		}
+	})
+}
+
+// Test that pg_dump's verbose stderr lines reach the Progress callback,
+// including a final line without a trailing newline.
+func TestPgDumpToFileWithOptions_Progress(t *testing.T) {
+	tmpdir := t.TempDir()
+	script := `#!/usr/bin/env bash
+echo "pg_dump: last built-in OID is 16383" >&2
+echo "pg_dump: reading extensions" >&2
+echo "pg_dump: dumping contents of table \"public.users\"" >&2
+printf "pg_dump: saving database definition" >&2
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+
+	var lines []string
+	opts := PgDumpOptions{Progress: func(line string) { lines = append(lines, line) }}
+	withPathPrepended(tmpdir, func() {
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+	})
+	want := []string{
+		"pg_dump: last built-in OID is 16383",
+		"pg_dump: reading extensions",
+		`pg_dump: dumping contents of table "public.users"`,
+		"pg_dump: saving database definition",
+	}
+	if !slices.Equal(lines, want) {
+		t.Fatalf("got progress lines %q, want %q", lines, want)
+	}
+}
+
+// Test that sslmode from the URL and SSL settings from ExtraEnv reach
+// pg_dump's environment, with ExtraEnv taking precedence.
+func TestPgDumpToFileWithOptions_SSLEnv(t *testing.T) {
+	tmpdir := t.TempDir()
+	envFile := filepath.Join(tmpdir, "env")
+	script := `#!/usr/bin/env bash
+env | grep '^PGSSL' | sort > "` + envFile + `"
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+	for _, name := range []string{"PGSSLMODE", "PGSSLCERT", "PGSSLKEY", "PGSSLROOTCERT"} {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	opts := PgDumpOptions{ExtraEnv: map[string]string{
+		"PGSSLCERT":     "/certs/client.crt",
+		"PGSSLKEY":      "/certs/client.key",
+		"PGSSLROOTCERT": "/certs/root.crt",
+	}}
+	withPathPrepended(tmpdir, func() {
+		dbURL := "postgres://u:p@h:1234/db?sslmode=verify-full&sslcert=/url/client.crt"
+		if err := PgDumpToFileWithOptions(context.Background(), dbURL, "out", 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+	})
+	b, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("read env file: %v", err)
+	}
+	want := []string{
+		"PGSSLCERT=/certs/client.crt",
+		"PGSSLKEY=/certs/client.key",
+		"PGSSLMODE=verify-full",
+		"PGSSLROOTCERT=/certs/root.crt",
+	}
+	if got := strings.Fields(string(b)); !slices.Equal(got, want) {
+		t.Fatalf("got env %q, want %q", got, want)
+	}
+}
+
+// Test that an IPv6 host and an encoded password reach pg_dump intact.
+func TestPgDumpToFile_IPv6AndEncodedPassword(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" "PGPASSWORD=$PGPASSWORD" > "` + argsFile + `"
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+
+	withPathPrepended(tmpdir, func() {
+		err := PgDumpToFile(context.Background(), "postgres://u:p%40ss%2Fword@[::1]:5432/db", "out", 5*time.Second)
+		if err != nil {
+			t.Fatalf("PgDumpToFile failed: %v", err)
+		}
+		args := readArgs(t, argsFile)
+		if host, _ := flagValue(args, "-h"); host != "::1" {
+			t.Fatalf("expected -h ::1, got %q", host)
+		}
+		if args[len(args)-1] != "PGPASSWORD=p@ss/word" {
+			t.Fatalf("expected decoded PGPASSWORD, got %q", args[len(args)-1])
+		}
+	})
+}
+
+func TestPgDumpToFile_UnixSocket(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "pg_dump")
+	withPathPrepended(dir, func() {
+		err := PgDumpToFileWithOptions(context.Background(), "postgres://app@/mydb?host=/var/run/postgresql", "out", 5*time.Second, PgDumpOptions{PasswordOptional: true})
+		if err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+	})
+	args := readArgs(t, argsFile)
+	if host, _ := flagValue(args, "-h"); host != "/var/run/postgresql" {
+		t.Fatalf("expected -h /var/run/postgresql, got %q", host)
+	}
+	if port, _ := flagValue(args, "-p"); port != DefaultPort {
+		t.Fatalf("expected -p %s, got %q", DefaultPort, port)
+	}
+}
+
+// Test that a socket URL naming neither user nor password dumps as PGUSER,
+// or the OS user, for peer authentication.
+func TestPgDumpToFile_UnixSocketPeer(t *testing.T) {
+	const dbURL = "postgres:///mydb?host=/var/run/postgresql"
+	runner := &fakeRunner{}
+	opts := PgDumpOptions{Runner: runner}
+
+	t.Setenv("PGUSER", "peer")
+	if err := PgDumpToFileWithOptions(context.Background(), dbURL, "out", 5*time.Second, opts); err != nil {
+		t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+	}
+	args := runner.calls[len(runner.calls)-1].args
+	if user, _ := flagValue(args, "-U"); user != "peer" {
+		t.Fatalf("expected -U peer, got %q", user)
+	}
+	if host, _ := flagValue(args, "-h"); host != "/var/run/postgresql" {
+		t.Fatalf("expected -h /var/run/postgresql, got %q", host)
+	}
+
+	t.Setenv("PGUSER", "")
+	osUser, err := user.Current()
+	if err != nil {
+		t.Skipf("current user unknown: %v", err)
+	}
+	if err := PgDumpToFileWithOptions(context.Background(), dbURL, "out", 5*time.Second, opts); err != nil {
+		t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+	}
+	if u, _ := flagValue(runner.calls[len(runner.calls)-1].args, "-U"); u != osUser.Username {
+		t.Fatalf("expected -U %s, got %q", osUser.Username, u)
+	}
+}
+
+func TestPgDumpOptions_Jobs(t *testing.T) {
+	cfg := &ConnConfig{User: "u", Password: "p", Host: "h", Port: "1234", Database: "db"}
+	outDir := filepath.Join(t.TempDir(), "backup")
+
+	args, err := PgDumpOptions{Jobs: 4}.args(cfg, outDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if f, _ := flagValue(args, "-F"); f != "d" {
+		t.Fatalf("expected -F d, got %q", f)
+	}
+	if j, _ := flagValue(args, "-j"); j != "4" {
+		t.Fatalf("expected -j 4, got %q", j)
+	}
+
+	if _, err := (PgDumpOptions{Jobs: 4, Format: DumpFormatCustom}).args(cfg, outDir); err == nil {
+		t.Fatalf("expected error for parallel custom-format dump")
+	}
+
+	file := filepath.Join(t.TempDir(), "backup.dump")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if _, err := (PgDumpOptions{Jobs: 4}).args(cfg, file); err == nil {
+		t.Fatalf("expected error for parallel dump to a file")
+	}
+
+	args, err = PgDumpOptions{Jobs: 1}.args(cfg, file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := flagValue(args, "-j"); ok {
+		t.Fatalf("expected no -j for a single job")
+	}
+}
+
+// Test PgDumpToWriter streams stdout into the writer and keeps stderr out of it.
+func TestPgDumpToWriter(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" > "` + argsFile + `"
+echo "pg_dump: reading schemas" >&2
+printf 'PGDMP\x00binary'
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+
+	withPathPrepended(tmpdir, func() {
+		var buf bytes.Buffer
+		if err := PgDumpToWriter(context.Background(), "postgres://u:p@h:1234/db", &buf, 5*time.Second); err != nil {
+			t.Fatalf("PgDumpToWriter failed: %v", err)
+		}
+		if got := buf.String(); got != "PGDMP\x00binary" {
+			t.Fatalf("unexpected stream contents: %q", got)
+		}
+		if _, ok := flagValue(readArgs(t, argsFile), "-f"); ok {
+			t.Fatalf("expected no -f when streaming")
+		}
+	})
+
+	err := PgDumpToWriterWithOptions(context.Background(), "postgres://u:p@h:1234/db", io.Discard, 5*time.Second, PgDumpOptions{Format: DumpFormatDirectory})
+	if err == nil {
+		t.Fatalf("expected error streaming a directory-format dump")
+	}
+}
+
+// Test that a gzipped dump failing partway leaves no truncated file behind.
+func TestPgDumpToFileWithOptions_GzipFailureRemovesFile(t *testing.T) {
+	runner := &fakeRunner{run: func(_ context.Context, stdout, _ io.Writer) error {
+		if _, err := io.WriteString(stdout, "CREATE TABLE t ();\n"); err != nil {
+			return err
+		}
+		return exitError(1)
+	}}
+	outFile := filepath.Join(t.TempDir(), "backup.sql.gz")
+	opts := PgDumpOptions{Format: DumpFormatPlain, Compression: 6, Runner: runner}
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, opts)
+	if !errors.Is(err, ErrDumpFailed) {
+		t.Fatalf("expected ErrDumpFailed, got %v", err)
+	}
+	if _, err := os.Stat(outFile); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the partial dump to be removed, got %v", err)
+	}
+}
+
+func TestPgDumpToFileWithOptions_Compression(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" > "` + argsFile + `"
+echo "CREATE TABLE t ();"
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+
+	withPathPrepended(tmpdir, func() {
+		outFile := filepath.Join(t.TempDir(), "backup.sql.gz")
+		opts := PgDumpOptions{Format: DumpFormatPlain, Compression: 6}
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+		b, err := os.ReadFile(outFile)
+		if err != nil {
+			t.Fatalf("read out file: %v", err)
+		}
+		if len(b) < 2 || b[0] != 0x1f || b[1] != 0x8b {
+			t.Fatalf("expected gzip header, got % x", b[:min(len(b), 4)])
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("gzip reader: %v", err)
+		}
+		plain, _ := io.ReadAll(zr)
+		if string(plain) != "CREATE TABLE t ();\n" {
+			t.Fatalf("unexpected dump contents: %q", plain)
+		}
+		args := readArgs(t, argsFile)
+		if _, ok := flagValue(args, "-Z"); ok {
+			t.Fatalf("expected no -Z for in-process gzip")
+		}
+		if _, ok := flagValue(args, "-f"); ok {
+			t.Fatalf("expected no -f for in-process gzip")
+		}
+
+		opts = PgDumpOptions{Compression: 9}
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+		}
+		if z, _ := flagValue(readArgs(t, argsFile), "-Z"); z != "9" {
+			t.Fatalf("expected -Z 9 for custom format, got %q", z)
+		}
+	})
+
+	for _, opts := range []PgDumpOptions{
+		{Format: DumpFormatTar, Compression: 5},
+		{Compression: 10},
+	} {
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts); err == nil {
+			t.Fatalf("expected validation error for %+v", opts)
+		}
+	}
+}
+
+func TestPgDumpToFileWithResult(t *testing.T) {
+	dir := writeFakeDumpOutput(t)
+	outFile := filepath.Join(t.TempDir(), "app.sql")
+
+	var res *DumpResult
+	withPathPrepended(dir, func() {
+		var err error
+		res, err = PgDumpToFileWithResult(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, PgDumpOptions{Format: DumpFormatPlain})
+		if err != nil {
+			t.Fatalf("PgDumpToFileWithResult: %v", err)
+		}
+	})
+
+	info, err := os.Stat(outFile)
+	if err != nil {
+		t.Fatalf("stat dump: %v", err)
+	}
+	if res.OutputPath != outFile || res.Bytes != info.Size() || res.Bytes == 0 {
+		t.Fatalf("got result %+v, want %s with %d bytes", res, outFile, info.Size())
+	}
+	if res.Duration <= 0 {
+		t.Fatalf("expected a positive duration, got %s", res.Duration)
+	}
+	if res.Format != DumpFormatPlain {
+		t.Fatalf("expected plain format, got %q", res.Format)
+	}
+}
+
+// Test that cancelling a dump stops pg_dump and the processes it spawned,
+// rather than leaving them to finish the dump in the background.
+func TestPgDumpToFile_CancelStopsChildren(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/usr/bin/env bash
+out=
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-f" ]; then out=$2; fi
+	shift
+done
+printf 'start\n' > "$out"
+(sleep 1; printf 'child\n' >> "$out") &
+sleep 1
+printf 'done\n' >> "$out"
+`
+	if err := os.WriteFile(filepath.Join(dir, "pg_dump"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+	outFile := filepath.Join(t.TempDir(), "app.dump")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	err := PgDumpToFileWithOptions(ctx, "postgres://u:p@h:1234/db", outFile, time.Minute, PgDumpOptions{Binary: filepath.Join(dir, "pg_dump")})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected pg_dump to stop on cancellation; took %v", elapsed)
+	}
+
+	// give any survivor time to finish its write
+	time.Sleep(1500 * time.Millisecond)
+	b, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read out file: %v", err)
+	}
+	if string(b) != "start\n" {
+		t.Fatalf("expected pg_dump and its child to be stopped, got output %q", b)
+	}
+}
+
+// versionRunner returns a fakeRunner that answers --version as pg_dump
+// version and succeeds otherwise.
+func versionRunner(version string) *fakeRunner {
+	r := &fakeRunner{}
+	r.run = func(_ context.Context, stdout, _ io.Writer) error {
+		if args := r.calls[len(r.calls)-1].args; slices.Equal(args, []string{"--version"}) {
+			fmt.Fprintf(stdout, "pg_dump (PostgreSQL) %s\n", version)
+		}
+		return nil
+	}
+	return r
+}
+
+// Test that CompressionMethod maps to --compress on pg_dump 16 and falls back
+// to -Z, or fails for lz4 and zstd, on older versions.
+func TestPgDumpToFileWithOptions_CompressionMethod(t *testing.T) {
+	cases := []struct {
+		version string
+		method  CompressionMethod
+		level   int
+		format  DumpFormat
+		want    []string
+	}{
+		{"16.2", CompressionZstd, 3, "", []string{"--compress=zstd:3"}},
+		{"16.2", CompressionLZ4, 0, "", []string{"--compress=lz4"}},
+		{"16.2", CompressionGzip, 9, DumpFormatPlain, []string{"--compress=gzip:9"}},
+		{"16.2", CompressionNone, 0, "", []string{"--compress=none"}},
+		{"15.6", CompressionGzip, 0, "", []string{"-Z", "6"}},
+		{"15.6", CompressionGzip, 4, "", []string{"-Z", "4"}},
+		{"15.6", CompressionNone, 0, "", []string{"-Z", "0"}},
+	}
+	for _, c := range cases {
+		runner := versionRunner(c.version)
+		opts := PgDumpOptions{Runner: runner, Quiet: true, Format: c.format, CompressionMethod: c.method, Compression: c.level}
+		if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts); err != nil {
+			t.Fatalf("pg_dump %s, %s:%d: unexpected error: %v", c.version, c.method, c.level, err)
+		}
+		args := runner.calls[len(runner.calls)-1].args
+		format, _ := flagValue(args, "-F")
+		want := append([]string{"-h", "h", "-p", "1234", "-U", "u", "-d", "db", "-F", format, "-b"}, c.want...)
+		want = append(want, "-f", "out")
+		if !slices.Equal(args, want) {
+			t.Fatalf("pg_dump %s, %s:%d: got args %v, want %v", c.version, c.method, c.level, args, want)
+		}
+	}
+
+	runner := versionRunner("15.6")
+	opts := PgDumpOptions{Runner: runner, CompressionMethod: CompressionZstd}
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts)
+	if err == nil || !strings.Contains(err.Error(), "needs pg_dump 16") {
+		t.Fatalf("expected zstd to be rejected for pg_dump 15, got %v", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Fatalf("expected only the version check to run, got %v", runner.calls)
+	}
+}
+
+func TestPgDumpOptions_CompressionMethodValidation(t *testing.T) {
+	bad := []PgDumpOptions{
+		{CompressionMethod: "brotli"},
+		{CompressionMethod: CompressionZstd, Compression: 23},
+		{CompressionMethod: CompressionLZ4, Compression: 13},
+		{CompressionMethod: CompressionGzip, Compression: 10},
+		{CompressionMethod: CompressionNone, Compression: 1},
+		{CompressionMethod: CompressionZstd, Format: DumpFormatTar},
+	}
+	for _, opts := range bad {
+		if err := opts.validate(); err == nil {
+			t.Fatalf("expected %s:%d (format %q) to be rejected", opts.CompressionMethod, opts.Compression, opts.Format)
+		}
+	}
+	ok := []PgDumpOptions{
+		{CompressionMethod: CompressionZstd, Compression: 22},
+		{CompressionMethod: CompressionLZ4, Compression: 12},
+		{CompressionMethod: CompressionNone, Format: DumpFormatTar},
+	}
+	for _, opts := range ok {
+		if err := opts.validate(); err != nil {
+			t.Fatalf("expected %s:%d to be accepted, got %v", opts.CompressionMethod, opts.Compression, err)
+		}
+	}
+}
+
+// Test that ErrorTailLines limits the stderr carried in the error message
+// while FullStderr keeps every line.
+func TestPgDumpToFile_ErrorTailLines(t *testing.T) {
+	runner := &fakeRunner{run: func(_ context.Context, _, stderr io.Writer) error {
+		for i := 1; i <= 100; i++ {
+			fmt.Fprintf(stderr, "pg_dump: dumping contents of table t%d\n", i)
+		}
+		io.WriteString(stderr, "pg_dump: error: permission denied for table t100\n")
+		return exitError(1)
+	}}
+	opts := PgDumpOptions{Runner: runner, ErrorTailLines: 2, Progress: func(string) {}}
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts)
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected a CommandError, got %v", err)
+	}
+	wantTail := "pg_dump: dumping contents of table t100\npg_dump: error: permission denied for table t100"
+	if cmdErr.Stderr != wantTail || !strings.HasSuffix(err.Error(), wantTail) {
+		t.Fatalf("expected only the last two lines in the error, got %q", err.Error())
+	}
+	full := strings.Split(cmdErr.FullStderr(), "\n")
+	if len(full) != 101 || full[0] != "pg_dump: dumping contents of table t1" {
+		t.Fatalf("expected all 101 lines from FullStderr, got %d starting %q", len(full), full[0])
+	}
+
+	opts.ErrorTailLines = 0
+	err = PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, opts)
+	if !errors.As(err, &cmdErr) || strings.Count(cmdErr.Stderr, "\n") != stderrTailLines-1 {
+		t.Fatalf("expected %d lines by default, got %q", stderrTailLines, cmdErr.Stderr)
+	}
+}
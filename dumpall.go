@@ -0,0 +1,79 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PgDumpAllOptions controls how PgDumpAllToFileWithOptions invokes pg_dumpall.
+// The zero value matches PgDumpAllToFile.
+type PgDumpAllOptions struct {
+	// Binary is the path to the pg_dumpall executable. When empty,
+	// pg_dumpall is resolved from PATH.
+	Binary string
+
+	// GlobalsOnly dumps only roles and tablespaces (--globals-only), not
+	// the databases themselves.
+	GlobalsOnly bool
+
+	// PasswordOptional accepts an adminURL without a password; pg_dumpall
+	// then authenticates through ~/.pgpass or an inherited PGPASSWORD.
+	PasswordOptional bool
+
+	// ExtraEnv sets additional environment variables for pg_dumpall, as for
+	// PgDumpOptions.ExtraEnv.
+	ExtraEnv map[string]string
+}
+
+// PgDumpAllToFile runs pg_dumpall against the cluster in adminURL and writes
+// the plain SQL script, covering roles, tablespaces and every database, to
+// outFile. The database in adminURL is the one pg_dumpall first connects to.
+// A timeout is applied by deriving a child context from parentCtx.
+func PgDumpAllToFile(parentCtx context.Context, adminURL, outFile string, timeout time.Duration) error {
+	return PgDumpAllToFileWithOptions(parentCtx, adminURL, outFile, timeout, PgDumpAllOptions{})
+}
+
+// PgDumpAllToFileWithOptions is like PgDumpAllToFile but lets the caller
+// control the pg_dumpall invocation through opts. A partially written outFile
+// is removed on failure.
+func PgDumpAllToFileWithOptions(parentCtx context.Context, adminURL, outFile string, timeout time.Duration, opts PgDumpAllOptions) (err error) {
+	cfg, err := ParseConnConfigWithOptions(adminURL, ParseOptions{PasswordOptional: opts.PasswordOptional})
+	if err != nil {
+		return fmt.Errorf("parse db url: %w", err)
+	}
+	bin, err := lookupBinary(opts.Binary, "pg_dumpall", ErrDumpFailed)
+	if err != nil {
+		return err
+	}
+
+	// pg_dumpall only gained -f in PostgreSQL 10, so redirect stdout instead
+	f, err := os.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("create dump file: %w", err)
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil && cerr != nil {
+			err = fmt.Errorf("close dump file: %w", cerr)
+		}
+		if err != nil {
+			os.Remove(outFile)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	args := []string{
+		"-h", cfg.Host,
+		"-p", cfg.Port,
+		"-U", cfg.User,
+		"-l", cfg.Database,
+		"-v",
+	}
+	if opts.GlobalsOnly {
+		args = append(args, "--globals-only")
+	}
+	return runTool(ctx, toolCommand{bin: bin, args: args, env: cfg.toolEnv(opts.ExtraEnv), stdout: f}, "pg_dumpall", ErrDumpFailed)
+}
@@ -0,0 +1,79 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPgDumpAllToFile(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" "PGPASSWORD=$PGPASSWORD" > "` + argsFile + `"
+echo "CREATE ROLE app;"
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dumpall"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dumpall: %v", err)
+	}
+	outFile := filepath.Join(t.TempDir(), "cluster.sql")
+
+	withPathPrepended(tmpdir, func() {
+		opts := PgDumpAllOptions{GlobalsOnly: true}
+		if err := PgDumpAllToFileWithOptions(context.Background(), "postgres://u:p@h:1234/postgres", outFile, 5*time.Second, opts); err != nil {
+			t.Fatalf("PgDumpAllToFileWithOptions failed: %v", err)
+		}
+	})
+	want := []string{"-h", "h", "-p", "1234", "-U", "u", "-l", "postgres", "-v", "--globals-only", "PGPASSWORD=p"}
+	if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+		t.Fatalf("got args %v, want %v", got, want)
+	}
+	b, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read dump: %v", err)
+	}
+	if string(b) != "CREATE ROLE app;\n" {
+		t.Fatalf("expected stdout in dump file, got %q", b)
+	}
+}
+
+func TestPgDumpAllToFile_NotFound(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "cluster.sql")
+	opts := PgDumpAllOptions{Binary: filepath.Join(t.TempDir(), "pg_dumpall")}
+	err := PgDumpAllToFileWithOptions(context.Background(), "postgres://u:p@h:1234/postgres", outFile, 5*time.Second, opts)
+	if !errors.Is(err, ErrBinaryNotFound) || !errors.Is(err, ErrDumpFailed) {
+		t.Fatalf("expected ErrBinaryNotFound and ErrDumpFailed, got %v", err)
+	}
+	if _, err := os.Stat(outFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no dump file to be created, got %v", err)
+	}
+}
+
+// Test that a slow pg_dumpall is killed at the timeout and its partial output
+// removed.
+func TestPgDumpAllToFile_Timeout(t *testing.T) {
+	tmpdir := t.TempDir()
+	script := "#!/usr/bin/env bash\necho 'partial'\nsleep 3\n"
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dumpall"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dumpall: %v", err)
+	}
+	outFile := filepath.Join(t.TempDir(), "cluster.sql")
+
+	withPathPrepended(tmpdir, func() {
+		start := time.Now()
+		err := PgDumpAllToFile(context.Background(), "postgres://u:p@h:1234/postgres", outFile, 200*time.Millisecond)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("expected pg_dumpall to be killed at the timeout; took %v", elapsed)
+		}
+	})
+	if _, err := os.Stat(outFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected partial dump file to be removed, got %v", err)
+	}
+}
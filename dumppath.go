@@ -0,0 +1,38 @@
+package psqltoolbox
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResolveDumpPath expands the placeholders in template to build a dump path,
+// e.g. "backups/{db}-{timestamp}.dump" to
+// "backups/mydb-2024-06-01T03:00:00Z.dump". The placeholders are {db} for
+// dbName, {date} for 2024-06-01, {time} for 03-00-00 and {timestamp} for the
+// RFC 3339 form 2024-06-01T03:00:00Z, all in UTC so that names sort by time
+// wherever they are generated. Other text, including unknown placeholders,
+// is kept verbatim.
+func ResolveDumpPath(template, dbName string, t time.Time) string {
+	t = t.UTC()
+	return strings.NewReplacer(
+		"{db}", dbName,
+		"{date}", t.Format(time.DateOnly),
+		"{time}", t.Format("15-04-05"),
+		"{timestamp}", t.Format(time.RFC3339),
+	).Replace(template)
+}
+
+// resolveOutFile returns outFile, expanded by ResolveDumpPath with the
+// database named in dbURL and the current time when opts.OutFileTemplate is
+// set.
+func resolveOutFile(dbURL, outFile string, opts PgDumpOptions) (string, error) {
+	if !opts.OutFileTemplate {
+		return outFile, nil
+	}
+	cfg, err := ParseConnConfigWithOptions(dbURL, ParseOptions{PasswordOptional: opts.PasswordOptional})
+	if err != nil {
+		return "", fmt.Errorf("parse db url: %w", err)
+	}
+	return ResolveDumpPath(outFile, cfg.Database, time.Now()), nil
+}
@@ -0,0 +1,58 @@
+package psqltoolbox
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestResolveDumpPath(t *testing.T) {
+	// 05:00 in UTC+2 is 03:00 UTC
+	at := time.Date(2024, 6, 1, 5, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	cases := map[string]string{
+		"backups/{db}.dump":            "backups/mydb.dump",
+		"backups/{date}.dump":          "backups/2024-06-01.dump",
+		"backups/{time}.dump":          "backups/03-00-00.dump",
+		"backups/{timestamp}.dump":     "backups/2024-06-01T03:00:00Z.dump",
+		"{db}/{date}/{db}-{time}.dump": "mydb/2024-06-01/mydb-03-00-00.dump",
+		"backups/latest.dump":          "backups/latest.dump",
+		"backups/{host}-{db}.dump":     "backups/{host}-mydb.dump",
+	}
+	for template, want := range cases {
+		if got := ResolveDumpPath(template, "mydb", at); got != want {
+			t.Fatalf("ResolveDumpPath(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+// Test that OutFileTemplate expands the output path before pg_dump runs and
+// that the result reports the expanded path.
+func TestPgDumpToFileWithResult_OutFileTemplate(t *testing.T) {
+	dir := t.TempDir()
+	runner := &fakeRunner{}
+	runner.run = func(context.Context, io.Writer, io.Writer) error {
+		args := runner.calls[len(runner.calls)-1].args
+		return os.WriteFile(args[len(args)-1], []byte("dump"), 0o644)
+	}
+	opts := PgDumpOptions{Runner: runner, OutFileTemplate: true}
+	before := time.Now().UTC().Format(time.DateOnly)
+
+	res, err := PgDumpToFileWithResult(context.Background(), "postgres://u:p@h:1234/app", filepath.Join(dir, "{db}-{date}.dump"), 5*time.Second, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the date may roll over during the dump
+	after := time.Now().UTC().Format(time.DateOnly)
+	if base := filepath.Base(res.OutputPath); base != "app-"+before+".dump" && base != "app-"+after+".dump" {
+		t.Fatalf("expected an expanded path, got %q", res.OutputPath)
+	}
+	if got, _ := flagValue(runner.calls[0].args, "-f"); got != res.OutputPath {
+		t.Fatalf("expected pg_dump to write %q, got -f %q", res.OutputPath, got)
+	}
+	if res.Bytes != 4 {
+		t.Fatalf("expected the expanded file to be measured, got %d bytes", res.Bytes)
+	}
+}
@@ -0,0 +1,26 @@
+package psqltoolbox
+
+import "errors"
+
+// Sentinel errors shared across the package. Returned errors wrap them, so
+// match with errors.Is rather than comparing error text.
+var (
+	// ErrInvalidURL means a connection URL could not be parsed or is missing
+	// required components.
+	ErrInvalidURL = errors.New("invalid database url")
+
+	// ErrBinaryNotFound means a client tool (pg_dump, pg_restore, migrate)
+	// could not be found on PATH or at its configured path.
+	ErrBinaryNotFound = errors.New("executable not found")
+
+	// ErrDumpFailed, ErrRestoreFailed and ErrMigrateFailed mean the
+	// corresponding client tool could not be run or exited with an error.
+	// ErrDumpFailed covers pg_dumpall as well as pg_dump.
+	ErrDumpFailed    = errors.New("pg_dump failed")
+	ErrRestoreFailed = errors.New("pg_restore failed")
+	ErrMigrateFailed = errors.New("migrate failed")
+
+	// ErrMetadataFailed means a dump succeeded but its WriteMetadata sidecar
+	// could not be written. The dump itself is left in place.
+	ErrMetadataFailed = errors.New("dump metadata failed")
+)
@@ -0,0 +1,95 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestErrors_InvalidURL(t *testing.T) {
+	for _, raw := range []string{"", "mysql://u:p@h:1/db", "postgres://u@h:1/db", "postgres://u:p@h:1/db\x7f"} {
+		if _, err := ParseConnConfig(raw); !errors.Is(err, ErrInvalidURL) {
+			t.Fatalf("ParseConnConfig(%q): expected ErrInvalidURL, got %v", raw, err)
+		}
+	}
+	err := PgDumpToFile(context.Background(), "mysql://u:p@h:1/db", "out", time.Second)
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("PgDumpToFile: expected ErrInvalidURL, got %v", err)
+	}
+}
+
+func TestErrors_BinaryNotFound(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "pg_dump")
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1/db", "out", time.Second, PgDumpOptions{Binary: missing})
+	if !errors.Is(err, ErrBinaryNotFound) || !errors.Is(err, ErrDumpFailed) {
+		t.Fatalf("expected ErrBinaryNotFound and ErrDumpFailed, got %v", err)
+	}
+
+	err = PgRestoreFromFileWithOptions(context.Background(), "postgres://u:p@h:1/db", "in", time.Second, PgRestoreOptions{Binary: missing})
+	if !errors.Is(err, ErrBinaryNotFound) || !errors.Is(err, ErrRestoreFailed) {
+		t.Fatalf("expected ErrBinaryNotFound and ErrRestoreFailed, got %v", err)
+	}
+
+	err = checkDumpCompatibility(context.Background(), PgDumpOptions{Binary: missing}, nil)
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Fatalf("expected ErrBinaryNotFound, got %v", err)
+	}
+}
+
+func TestErrors_ToolFailures(t *testing.T) {
+	tmpdir := t.TempDir()
+	for _, name := range []string{"pg_dump", "pg_restore", "migrate"} {
+		if err := os.WriteFile(filepath.Join(tmpdir, name), []byte("#!/usr/bin/env bash\nexit 3\n"), 0o755); err != nil {
+			t.Fatalf("write fake %s: %v", name, err)
+		}
+	}
+
+	withPathPrepended(tmpdir, func() {
+		ctx := context.Background()
+		checks := []struct {
+			err  error
+			kind error
+		}{
+			{PgDumpToFile(ctx, "postgres://u:p@h:1/db", "out", time.Second), ErrDumpFailed},
+			{PgRestoreFromFile(ctx, "postgres://u:p@h:1/db", "in", time.Second), ErrRestoreFailed},
+			{MigrateDown(ctx, "postgres://u:p@h:1/db", "/migrations", 1), ErrMigrateFailed},
+		}
+		for _, c := range checks {
+			if !errors.Is(c.err, c.kind) {
+				t.Fatalf("expected %v, got %v", c.kind, c.err)
+			}
+			var exitErr *exec.ExitError
+			if !errors.As(c.err, &exitErr) || exitErr.ExitCode() != 3 {
+				t.Fatalf("expected wrapped exit status 3, got %v", c.err)
+			}
+			var cmdErr *CommandError
+			if !errors.As(c.err, &cmdErr) || cmdErr.ExitCode != 3 {
+				t.Fatalf("expected a CommandError with ExitCode 3, got %v", c.err)
+			}
+			if errors.Is(c.err, ErrBinaryNotFound) {
+				t.Fatalf("did not expect ErrBinaryNotFound for %v", c.err)
+			}
+		}
+	})
+}
+
+// Test that a tool that could not be started reports ExitCode -1.
+func TestCommandError_NotStarted(t *testing.T) {
+	tmpdir := t.TempDir()
+	// not executable as a script: the interpreter does not exist
+	if err := os.WriteFile(filepath.Join(tmpdir, "pg_dump"), []byte("#!/nonexistent/shell\n"), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+	var err error
+	withPathPrepended(tmpdir, func() {
+		err = PgDumpToFile(context.Background(), "postgres://u:p@h:1/db", "out", time.Second)
+	})
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || cmdErr.ExitCode != -1 || cmdErr.Name != "pg_dump" {
+		t.Fatalf("expected a pg_dump CommandError with ExitCode -1, got %#v", err)
+	}
+}
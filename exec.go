@@ -0,0 +1,354 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// toolKillGrace is how long a tool stopped by its context, and any process it
+// spawned, gets to exit after SIGTERM before it is killed. It also bounds how
+// long runTool waits for the tool's output pipes to close, since
+// grandchildren it spawned may keep them open.
+const toolKillGrace = 5 * time.Second
+
+// stderrTailLines is how many trailing stderr lines of a failed client tool
+// are included in the returned error by default.
+const stderrTailLines = 20
+
+// fullStderrLimit is how many bytes of a client tool's stderr are kept for
+// CommandError.FullStderr, so that a verbose run does not hold all of its
+// output in memory.
+const fullStderrLimit = 4 << 20
+
+// truncatedMarker starts the output of a cappedWriter that dropped some.
+const truncatedMarker = "[earlier output truncated]"
+
+// cappedWriter is an io.Writer that retains the last max bytes written to it,
+// using at most twice that in memory.
+type cappedWriter struct {
+	mu        sync.Mutex
+	max       int
+	buf       []byte
+	truncated bool
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > 2*w.max {
+		w.buf = append([]byte(nil), w.buf[len(w.buf)-w.max:]...)
+		w.truncated = true
+	}
+	return len(p), nil
+}
+
+// String returns the retained output. When earlier output was dropped, it
+// starts at the first complete line and is prefixed with truncatedMarker.
+func (w *cappedWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := w.buf
+	if len(buf) > w.max {
+		buf = buf[len(buf)-w.max:]
+		w.truncated = true
+	}
+	if !w.truncated {
+		return strings.TrimSpace(string(buf))
+	}
+	if i := bytes.IndexByte(buf, '\n'); i >= 0 {
+		buf = buf[i+1:]
+	}
+	return truncatedMarker + "\n" + strings.TrimSpace(string(buf))
+}
+
+// tailWriter is an io.Writer that retains the last max lines written to it.
+type tailWriter struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+}
+
+func newTailWriter(max int) *tailWriter {
+	return &tailWriter{max: max}
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	buf := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.lines = append(w.lines, strings.TrimRight(string(buf[:i]), "\r"))
+		if len(w.lines) > w.max {
+			w.lines = w.lines[len(w.lines)-w.max:]
+		}
+		buf = buf[i+1:]
+	}
+	w.partial = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// String returns the retained lines joined by newlines.
+func (w *tailWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	lines := w.lines
+	if len(w.partial) > 0 {
+		lines = append(lines[:len(lines):len(lines)], string(w.partial))
+	}
+	if len(lines) > w.max {
+		lines = lines[len(lines)-w.max:]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// lineWriter is an io.Writer that calls fn with each complete line written to
+// it, without the line ending. A trailing partial line is delivered by flush,
+// after which further writes are discarded.
+type lineWriter struct {
+	mu      sync.Mutex
+	fn      func(line string)
+	partial []byte
+	closed  bool
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return len(p), nil
+	}
+	buf := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimRight(string(buf[:i]), "\r"))
+		buf = buf[i+1:]
+	}
+	w.partial = append([]byte(nil), buf...)
+	return len(p), nil
+}
+
+// flush delivers any trailing partial line and stops further calls to fn.
+func (w *lineWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed && len(w.partial) > 0 {
+		w.fn(strings.TrimRight(string(w.partial), "\r"))
+	}
+	w.partial = nil
+	w.closed = true
+}
+
+// CommandError is returned when a client tool such as pg_dump, pg_restore or
+// migrate fails; retrieve it with errors.As. It wraps the tool's failure kind
+// (e.g. ErrDumpFailed), the underlying exec error, ErrBinaryNotFound when the
+// executable is missing, and the context error when the tool was killed by a
+// timeout or cancellation.
+type CommandError struct {
+	// Name is the tool and, for migrate, its subcommand, e.g. "migrate up".
+	Name string
+	// ExitCode is the tool's exit status, or -1 if it did not exit on its
+	// own, e.g. because it could not be started or was killed.
+	ExitCode int
+	// Stderr holds the last lines the tool wrote to stderr, with passwords
+	// redacted: 20 by default, or PgDumpOptions.ErrorTailLines for pg_dump.
+	Stderr string
+
+	fullStderr string
+	causes     []error
+}
+
+// FullStderr returns what the tool wrote to stderr, with passwords redacted,
+// of which Stderr is the tail. Only the last 4 MiB are kept; when more was
+// written, the result starts with "[earlier output truncated]".
+func (e *CommandError) FullStderr() string {
+	return e.fullStderr
+}
+
+func (e *CommandError) Error() string {
+	msg := e.Name + " failed: " + e.causes[1].Error()
+	if e.Stderr != "" {
+		msg += ": " + e.Stderr
+	}
+	return msg
+}
+
+func (e *CommandError) Unwrap() []error {
+	return e.causes
+}
+
+// CommandRunner runs the client tools such as pg_dump and migrate. The
+// default, ExecRunner, starts them as local processes; tests or callers that
+// run the tools elsewhere, e.g. in a container, can supply their own through
+// PgDumpOptions.Runner or MigrateOptions.Runner. CommandRunner has no stdin,
+// so runs that need one, such as PgRestoreFromReader, always start the tool
+// with exec directly and bypass any custom Runner.
+type CommandRunner interface {
+	// Run runs name with args and waits for it to finish. A nil env means
+	// the current process's environment. stdout and stderr are never nil.
+	// Run must return once ctx is done, and an error reporting an exit
+	// status should have an ExitCode() int method, as *exec.ExitError does,
+	// for CommandError.ExitCode.
+	Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error
+}
+
+// ExecRunner is the CommandRunner used when none is set. On Unix the tool
+// runs in a process group of its own, so that when ctx is done the tool and
+// anything it spawned get SIGTERM, and whatever is left after toolKillGrace
+// gets SIGKILL.
+type ExecRunner struct {
+	stdin io.Reader
+}
+
+// Run implements CommandRunner.
+func (r ExecRunner) Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = env
+	cmd.Stdin = r.stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = toolKillGrace
+	killRest := setProcessGroup(cmd)
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		// the tool has exited or been killed; its children may not have
+		killRest(toolKillGrace)
+	}
+	return err
+}
+
+// runnerOrDefault returns r, or ExecRunner when r is nil.
+func runnerOrDefault(r CommandRunner) CommandRunner {
+	if r == nil {
+		return ExecRunner{}
+	}
+	return r
+}
+
+// toolCommand is a client tool invocation for runTool. A nil stdout or
+// stderr is forwarded to the process streams. CommandRunner has no stdin, so
+// a command with one always runs through ExecRunner. tailLines is how many
+// stderr lines go into CommandError.Stderr, zero meaning stderrTailLines.
+type toolCommand struct {
+	runner         CommandRunner
+	bin            string
+	args, env      []string
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	tailLines      int
+}
+
+// runTool runs c through its runner. Stderr is also captured so that, on
+// failure, the returned error carries the tool's last diagnostic lines rather
+// than just its exit status. The error wraps kind; ctx bounds the run. Any of
+// dbURLs echoed by the tool are redacted in the error.
+func runTool(ctx context.Context, c toolCommand, name string, kind error, dbURLs ...string) error {
+	tailLines := c.tailLines
+	if tailLines <= 0 {
+		tailLines = stderrTailLines
+	}
+	tail := newTailWriter(tailLines)
+	full := &cappedWriter{max: fullStderrLimit}
+	stdout, stderr := c.stdout, c.stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
+
+	runner := runnerOrDefault(c.runner)
+	if c.stdin != nil {
+		runner = ExecRunner{stdin: c.stdin}
+	}
+	err := runner.Run(ctx, c.bin, c.args, c.env, stdout, io.MultiWriter(stderr, tail, full))
+	if err == nil {
+		return nil
+	}
+	terr := &CommandError{Name: name, ExitCode: -1, Stderr: tail.String(), fullStderr: full.String(), causes: []error{kind, err}}
+	for _, u := range dbURLs {
+		terr.Stderr = strings.ReplaceAll(terr.Stderr, u, RedactURL(u))
+		terr.fullStderr = strings.ReplaceAll(terr.fullStderr, u, RedactURL(u))
+	}
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		terr.ExitCode = exitErr.ExitCode()
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		terr.causes = append(terr.causes, ErrBinaryNotFound)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		terr.causes = append(terr.causes, ctxErr)
+	}
+	return terr
+}
+
+// binaryOrDefault returns path if set, otherwise name to be resolved from PATH.
+func binaryOrDefault(path, name string) string {
+	if path != "" {
+		return path
+	}
+	return name
+}
+
+// installHints tells users where to get each client tool.
+var installHints = map[string]string{
+	"pg_dump":    "install postgresql-client",
+	"pg_dumpall": "install postgresql-client",
+	"pg_restore": "install postgresql-client",
+	"migrate":    "install it from https://github.com/golang-migrate/migrate",
+}
+
+// toolBinary resolves tool name as lookupBinary does when runner is the
+// default ExecRunner. Other runners get path, or the bare name, unresolved,
+// since they may not run the tool from this machine's PATH at all.
+func toolBinary(runner CommandRunner, path, name string, kind error) (string, error) {
+	if _, ok := runnerOrDefault(runner).(ExecRunner); !ok {
+		return binaryOrDefault(path, name), nil
+	}
+	return lookupBinary(path, name, kind)
+}
+
+// lookupBinary resolves the executable for tool name, using path when set and
+// PATH otherwise. It fails up front with an actionable error wrapping
+// ErrBinaryNotFound and kind, if non-nil, rather than leaving exec to fail
+// mid-operation.
+func lookupBinary(path, name string, kind error) (string, error) {
+	bin, err := exec.LookPath(binaryOrDefault(path, name))
+	if err == nil {
+		return bin, nil
+	}
+	if path != "" {
+		err = fmt.Errorf("%w: %s not found at %s: %w", ErrBinaryNotFound, name, path, err)
+	} else {
+		err = fmt.Errorf("%w: %s not found in PATH; %s", ErrBinaryNotFound, name, installHints[name])
+	}
+	if kind != nil {
+		err = fmt.Errorf("%w: %w", kind, err)
+	}
+	return "", err
+}
@@ -0,0 +1,174 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeRunner is a CommandRunner that records each invocation and answers it
+// through run, succeeding when run is nil.
+type fakeRunner struct {
+	calls []fakeCall
+	run   func(ctx context.Context, stdout, stderr io.Writer) error
+}
+
+// fakeCall is an invocation recorded by fakeRunner.
+type fakeCall struct {
+	name      string
+	args, env []string
+}
+
+func (r *fakeRunner) Run(ctx context.Context, name string, args []string, env []string, stdout, stderr io.Writer) error {
+	r.calls = append(r.calls, fakeCall{name: name, args: args, env: env})
+	if r.run == nil {
+		return nil
+	}
+	return r.run(ctx, stdout, stderr)
+}
+
+// exitError is a tool failure with an exit status, like *exec.ExitError.
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestTailWriter_KeepsLastLines(t *testing.T) {
+	w := newTailWriter(2)
+	fmt.Fprint(w, "one\ntwo\nthr")
+	fmt.Fprint(w, "ee\nfour")
+	if got, want := w.String(), "three\nfour"; got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestCappedWriter_KeepsLastBytes(t *testing.T) {
+	w := &cappedWriter{max: 16}
+	fmt.Fprint(w, "line 1\nline 2\n")
+	if got := w.String(); got != "line 1\nline 2" {
+		t.Fatalf("expected output under the limit to be kept whole, got %q", got)
+	}
+	for i := 3; i <= 100; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	if len(w.buf) > 2*w.max {
+		t.Fatalf("expected at most %d bytes held, got %d", 2*w.max, len(w.buf))
+	}
+	if got, want := w.String(), truncatedMarker+"\nline 100"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestLineWriter_PartialLines(t *testing.T) {
+	var got []string
+	w := &lineWriter{fn: func(line string) { got = append(got, line) }}
+	fmt.Fprint(w, "one\r\ntw")
+	fmt.Fprint(w, "o\nthree")
+	w.flush()
+	fmt.Fprint(w, "after flush\n")
+	if want := []string{"one", "two", "three"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+// Test that a custom Runner receives pg_dump's invocation without a PATH
+// lookup and that its output reaches the writer.
+func TestPgDumpToWriter_Runner(t *testing.T) {
+	runner := &fakeRunner{run: func(_ context.Context, stdout, _ io.Writer) error {
+		_, err := io.WriteString(stdout, "dump")
+		return err
+	}}
+	var buf strings.Builder
+	opts := PgDumpOptions{Runner: runner, Format: DumpFormatPlain}
+	if err := PgDumpToWriterWithOptions(context.Background(), "postgres://u:secret@h:1234/db", &buf, 5*time.Second, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Fatalf("expected one run, got %v", runner.calls)
+	}
+	call := runner.calls[0]
+	if call.name != "pg_dump" {
+		t.Fatalf("expected the bare tool name, got %q", call.name)
+	}
+	if got, _ := flagValue(call.args, "-d"); got != "db" {
+		t.Fatalf("expected -d db, got %v", call.args)
+	}
+	if !slices.Contains(call.env, "PGPASSWORD=secret") {
+		t.Fatalf("expected PGPASSWORD in env, got %v", call.env)
+	}
+	if buf.String() != "dump" {
+		t.Fatalf("expected the runner's stdout as the dump, got %q", buf.String())
+	}
+}
+
+// Test that a runner's failure becomes a CommandError with its exit code and
+// stderr.
+func TestPgDumpToFile_RunnerFailure(t *testing.T) {
+	runner := &fakeRunner{run: func(_ context.Context, _, stderr io.Writer) error {
+		io.WriteString(stderr, "pg_dump: error: connection refused\n")
+		return exitError(1)
+	}}
+	err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", "out", 5*time.Second, PgDumpOptions{Runner: runner})
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) || !errors.Is(err, ErrDumpFailed) {
+		t.Fatalf("expected a CommandError wrapping ErrDumpFailed, got %v", err)
+	}
+	if cmdErr.ExitCode != 1 || cmdErr.Stderr != "pg_dump: error: connection refused" {
+		t.Fatalf("unexpected CommandError %+v", cmdErr)
+	}
+}
+
+// Test that migrate runs through MigrateOptions.Runner and that a runner
+// stopped by the timeout is reported as one.
+func TestMigrateDown_RunnerTimeout(t *testing.T) {
+	migrations := writeMigrations(t)
+	runner := &fakeRunner{}
+	opts := MigrateOptions{Runner: runner, Binary: "/opt/migrate/bin/migrate"}
+	if err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", migrations, 1, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.calls) != 1 || runner.calls[0].name != opts.Binary {
+		t.Fatalf("expected migrate run from Binary, got %v", runner.calls)
+	}
+	if args := runner.calls[0].args; !slices.Equal(args[len(args)-2:], []string{"down", "1"}) {
+		t.Fatalf("expected migrate down 1, got %v", args)
+	}
+
+	runner.run = func(ctx context.Context, _, _ io.Writer) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	opts.Timeout = 50 * time.Millisecond
+	err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", migrations, 1, opts)
+	if !errors.Is(err, ErrMigrateFailed) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a migrate timeout, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected the timeout in the message, got %v", err)
+	}
+}
+
+// Test that ExecRunner, the default, runs a local process with env.
+func TestExecRunner(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "tool")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$GREETING $1\"\nexit 3\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	err := ExecRunner{}.Run(context.Background(), script, []string{"world"}, []string{"GREETING=hello"}, &out, io.Discard)
+	var coded interface{ ExitCode() int }
+	if !errors.As(err, &coded) || coded.ExitCode() != 3 {
+		t.Fatalf("expected exit status 3, got %v", err)
+	}
+	if out.String() != "hello world\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+}
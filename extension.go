@@ -0,0 +1,26 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// EnsureExtensions runs CREATE EXTENSION IF NOT EXISTS for each of extensions
+// in order, e.g. uuid-ossp or pgcrypto before migrations that use them.
+// Extensions already installed are left alone. It stops at the first failure,
+// such as an extension whose files are not available on the server, and
+// names that extension in the error.
+func EnsureExtensions(ctx context.Context, conn Querier, extensions []string) error {
+	return ensureExtensions(ctx, conn, extensions)
+}
+
+func ensureExtensions(ctx context.Context, conn dbConn, extensions []string) error {
+	for _, name := range extensions {
+		if _, err := conn.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS "+pgx.Identifier{name}.Sanitize()); err != nil {
+			return fmt.Errorf("ensure extension %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package psqltoolbox
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnsureExtensions(t *testing.T) {
+	conn := &fakeConn{}
+	if err := ensureExtensions(context.Background(), conn, []string{"uuid-ossp", "pgcrypto"}); err != nil {
+		t.Fatalf("ensureExtensions: %v", err)
+	}
+	want := []string{
+		`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`,
+		`CREATE EXTENSION IF NOT EXISTS "pgcrypto"`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("got statements %q, want %q", conn.execs, want)
+	}
+}
+
+// Test that the first unavailable extension stops the run and is named.
+func TestEnsureExtensions_Failure(t *testing.T) {
+	conn := &fakeConn{execErrOn: func(sql string) bool { return strings.Contains(sql, "postgis") }}
+	err := ensureExtensions(context.Background(), conn, []string{"pgcrypto", "postgis", "citext"})
+	if err == nil || !strings.Contains(err.Error(), `"postgis"`) {
+		t.Fatalf("expected error naming postgis, got %v", err)
+	}
+	if want := []string{`CREATE EXTENSION IF NOT EXISTS "pgcrypto"`}; !slices.Equal(conn.execs, want) {
+		t.Fatalf("got statements %q, want %q", conn.execs, want)
+	}
+}
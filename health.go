@@ -0,0 +1,85 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Health is the status of a database reported by HealthReport.
+type Health struct {
+	// Connected is true once a connection has been established. The other
+	// fields are only filled in when it is.
+	Connected bool
+
+	// ServerVersion is the server_version setting, e.g. "16.2".
+	ServerVersion string
+
+	// Migrated is false when golang-migrate has not applied any migrations,
+	// in which case MigrationVersion and MigrationDirty are zero.
+	Migrated         bool
+	MigrationVersion uint
+	MigrationDirty   bool
+
+	// ActiveConnections is the number of sessions connected to the
+	// database, including the one HealthReport used.
+	ActiveConnections int64
+
+	// DatabaseSize is the size of the database on disk in bytes.
+	DatabaseSize int64
+}
+
+// healthSQL reads the server version, session count and size of the current
+// database in one query.
+const healthSQL = `
+SELECT current_setting('server_version'),
+       (SELECT count(*) FROM pg_stat_activity WHERE datname = current_database()),
+       pg_database_size(current_database())`
+
+// HealthReport connects to dbURL and gathers a Health report over that one
+// connection, all within timeout, e.g. for a monitoring endpoint. A Health is
+// returned even when an error is: a failure to connect leaves Connected
+// false and wraps ErrConnectFailed, while a failed query wraps ErrQueryFailed
+// and leaves the fields it would have filled in zero.
+func HealthReport(ctx context.Context, dbURL string, timeout time.Duration) (*Health, error) {
+	return healthReport(ctx, dbURL, timeout, pgxConnect)
+}
+
+func healthReport(ctx context.Context, dbURL string, timeout time.Duration, connect connector) (*Health, error) {
+	h := &Health{}
+	err := withConn(ctx, dbURL, timeout, connect, func(ctx context.Context, conn closableConn) error {
+		h.Connected = true
+		return readHealth(ctx, conn, h)
+	})
+	if err != nil {
+		return h, fmt.Errorf("health report: %w", err)
+	}
+	return h, nil
+}
+
+// readHealth fills in the fields of h that come from conn.
+func readHealth(ctx context.Context, conn dbConn, h *Health) error {
+	rows, err := conn.Query(ctx, healthSQL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrQueryFailed, err)
+	}
+	_, err = pgx.CollectExactlyOneRow(rows, func(r pgx.CollectableRow) (struct{}, error) {
+		return struct{}{}, r.Scan(&h.ServerVersion, &h.ActiveConnections, &h.DatabaseSize)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrQueryFailed, err)
+	}
+
+	version, dirty, err := migrationVersion(ctx, conn)
+	switch {
+	case errors.Is(err, ErrNoMigrations):
+	case err != nil:
+		return fmt.Errorf("%w: %w", ErrQueryFailed, err)
+	default:
+		h.Migrated, h.MigrationVersion, h.MigrationDirty = true, version, dirty
+	}
+	return nil
+}
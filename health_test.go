@@ -0,0 +1,66 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestHealthReport(t *testing.T) {
+	const dbURL = "postgres://u:p@h:1234/db"
+	conn := &fakeConn{rows: map[string][][]any{
+		healthSQL: {{"16.2", int64(7), int64(52428800)}},
+		`SELECT to_regclass('schema_migrations') IS NOT NULL`:  {{true}},
+		`SELECT version, dirty FROM schema_migrations LIMIT 1`: {{int64(20240101), false}},
+	}}
+	h, err := healthReport(context.Background(), dbURL, time.Second, connectTo(conn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Health{
+		Connected:         true,
+		ServerVersion:     "16.2",
+		Migrated:          true,
+		MigrationVersion:  20240101,
+		ActiveConnections: 7,
+		DatabaseSize:      52428800,
+	}
+	if *h != want {
+		t.Fatalf("got %+v, want %+v", *h, want)
+	}
+	if !conn.closed {
+		t.Fatalf("expected connection to be closed")
+	}
+
+	// a database that was never migrated is still healthy
+	conn = &fakeConn{rows: map[string][][]any{
+		healthSQL: {{"16.2", int64(1), int64(8192)}},
+		`SELECT to_regclass('schema_migrations') IS NOT NULL`: {{false}},
+	}}
+	h, err = healthReport(context.Background(), dbURL, time.Second, connectTo(conn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !h.Connected || h.Migrated || h.DatabaseSize != 8192 {
+		t.Fatalf("unexpected report %+v", *h)
+	}
+}
+
+func TestHealthReport_Failures(t *testing.T) {
+	const dbURL = "postgres://u:p@h:1234/db"
+	refused := func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+		return nil, errors.New("connection refused")
+	}
+	h, err := healthReport(context.Background(), dbURL, time.Second, refused)
+	if !errors.Is(err, ErrConnectFailed) || h == nil || h.Connected {
+		t.Fatalf("expected a disconnected report and ErrConnectFailed, got %+v, %v", h, err)
+	}
+
+	h, err = healthReport(context.Background(), dbURL, time.Second, connectTo(&fakeConn{}))
+	if !errors.Is(err, ErrQueryFailed) || h == nil || !h.Connected {
+		t.Fatalf("expected a connected report and ErrQueryFailed, got %+v, %v", h, err)
+	}
+}
@@ -0,0 +1,141 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// ErrNoMigrationFiles is returned when a migrations directory contains no
+// migration files, before any migration or reset is attempted.
+var ErrNoMigrationFiles = errors.New("no migration files found")
+
+// MigrateUpInProcess applies all pending up migrations in migrationsPath using
+// golang-migrate as a library, so no migrate binary needs to be installed.
+// Having nothing to apply (migrate.ErrNoChange) is not an error. Failing to
+// take golang-migrate's lock wraps ErrMigrationLocked; any other error from
+// the library is returned as is.
+func MigrateUpInProcess(ctx context.Context, dbURL, migrationsPath string) error {
+	src, err := (&file.File{}).Open("file://" + filepath.ToSlash(migrationsPath))
+	if err != nil {
+		return err
+	}
+	if err := checkHasMigrations(src, migrationsPath); err != nil {
+		return err
+	}
+	return migrateUpFromSource(ctx, "file", src, dbURL)
+}
+
+// MigrateUpFS is like MigrateUpInProcess but reads the migrations from dir
+// within fsys, such as an embed.FS compiled into the binary.
+func MigrateUpFS(ctx context.Context, dbURL string, fsys fs.FS, dir string) error {
+	src, err := iofs.New(fsys, dir)
+	if err != nil {
+		return err
+	}
+	if err := checkHasMigrations(src, dir); err != nil {
+		return err
+	}
+	return migrateUpFromSource(ctx, "iofs", src, dbURL)
+}
+
+// checkHasMigrations fails with ErrNoMigrationFiles, closing src, when src
+// holds no migrations. Without it golang-migrate reports a bare "file does not
+// exist" from deep inside Up.
+func checkHasMigrations(src source.Driver, dir string) error {
+	_, err := src.First()
+	if err == nil {
+		return nil
+	}
+	src.Close()
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w in %s", ErrNoMigrationFiles, dir)
+	}
+	return err
+}
+
+// migrateUpFromSource runs every pending up migration from src against the
+// PostgreSQL database at dbURL. src is closed before returning.
+func migrateUpFromSource(ctx context.Context, sourceName string, src source.Driver, dbURL string) error {
+	driverURL, err := pgxDriverURL(dbURL)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	m, err := migrate.NewWithSourceInstance(sourceName, src, driverURL)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	return migrateUp(ctx, m)
+}
+
+// migrateUp runs m.Up and closes m. Cancelling ctx asks golang-migrate to
+// stop after the migration in progress, and ctx.Err() is returned.
+func migrateUp(ctx context.Context, m *migrate.Migrate) (err error) {
+	defer func() {
+		srcErr, dbErr := m.Close()
+		if err == nil {
+			err = errors.Join(srcErr, dbErr)
+		}
+	}()
+
+	done := make(chan error, 1)
+	go func() { done <- m.Up() }()
+
+	select {
+	case err := <-done:
+		if errors.Is(err, migrate.ErrNoChange) {
+			return nil
+		}
+		return lockError(err)
+	case <-ctx.Done():
+		m.GracefulStop <- true
+		<-done
+		return ctx.Err()
+	}
+}
+
+// lockError wraps err in ErrMigrationLocked when it is one of golang-migrate's
+// lock failures, and otherwise returns it unchanged.
+func lockError(err error) error {
+	if errors.Is(err, database.ErrLocked) || errors.Is(err, migrate.ErrLocked) || errors.Is(err, migrate.ErrLockTimeout) {
+		return fmt.Errorf("%w: %w", ErrMigrationLocked, err)
+	}
+	return err
+}
+
+// pgxDriverURL rewrites a postgres:// URL to the pgx5:// scheme that selects
+// golang-migrate's pgx v5 database driver, setting application_name to
+// DefaultApplicationName when neither the URL nor PGAPPNAME names one.
+func pgxDriverURL(dbURL string) (string, error) {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			uerr.URL = RedactURL(uerr.URL)
+		}
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql":
+	default:
+		return "", fmt.Errorf("%w: unsupported scheme %q", ErrInvalidURL, u.Scheme)
+	}
+	u.Scheme = "pgx5"
+	if query := u.Query(); defaultAppName(query.Has("application_name")) != nil {
+		query.Set("application_name", DefaultApplicationName)
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
@@ -0,0 +1,168 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/database/stub"
+	"github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+func writeMigrations(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	up := "CREATE TABLE widgets (id int);"
+	if err := os.WriteFile(filepath.Join(dir, "1_create_widgets.up.sql"), []byte(up), 0o644); err != nil {
+		t.Fatalf("write migration: %v", err)
+	}
+	return dir
+}
+
+// Test that migrateUp applies the pending migration once and treats a second
+// run with nothing to do as success.
+func TestMigrateUp(t *testing.T) {
+	dir := writeMigrations(t)
+	db, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("stub driver: %v", err)
+	}
+
+	for i := range 2 {
+		src, err := (&file.File{}).Open("file://" + dir)
+		if err != nil {
+			t.Fatalf("open source: %v", err)
+		}
+		m, err := migrate.NewWithInstance("file", src, "stub", db)
+		if err != nil {
+			t.Fatalf("new migrate: %v", err)
+		}
+		if err := migrateUp(context.Background(), m); err != nil {
+			t.Fatalf("run %d: migrateUp failed: %v", i+1, err)
+		}
+	}
+
+	s := db.(*stub.Stub)
+	if s.CurrentVersion != 1 || s.IsDirty {
+		t.Fatalf("got version %d dirty=%v, want 1 clean", s.CurrentVersion, s.IsDirty)
+	}
+	if len(s.MigrationSequence) != 1 || s.MigrationSequence[0] != "CREATE TABLE widgets (id int);" {
+		t.Fatalf("unexpected migrations run: %q", s.MigrationSequence)
+	}
+}
+
+// Test that a lock held elsewhere is reported as ErrMigrationLocked and
+// nothing is applied.
+func TestMigrateUp_Locked(t *testing.T) {
+	db, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("stub driver: %v", err)
+	}
+	// another migration holds the lock
+	if err := db.Lock(); err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	src, err := (&file.File{}).Open("file://" + writeMigrations(t))
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	m, err := migrate.NewWithInstance("file", src, "stub", db)
+	if err != nil {
+		t.Fatalf("new migrate: %v", err)
+	}
+
+	err = migrateUp(context.Background(), m)
+	if !errors.Is(err, ErrMigrationLocked) || !errors.Is(err, database.ErrLocked) {
+		t.Fatalf("expected ErrMigrationLocked wrapping database.ErrLocked, got %v", err)
+	}
+	if s := db.(*stub.Stub); len(s.MigrationSequence) != 0 {
+		t.Fatalf("expected no migrations to run, got %q", s.MigrationSequence)
+	}
+}
+
+func TestMigrateUpInProcess_Errors(t *testing.T) {
+	dir := writeMigrations(t)
+	err := MigrateUpInProcess(context.Background(), "mysql://u:secret@h/db", dir)
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", err)
+	}
+
+	err = MigrateUpInProcess(context.Background(), "postgres://u:secret@h/db", filepath.Join(dir, "missing"))
+	if err == nil {
+		t.Fatalf("expected error for missing migrations directory")
+	}
+}
+
+func TestPgxDriverURL(t *testing.T) {
+	t.Setenv("PGAPPNAME", "")
+	got, err := pgxDriverURL("postgresql://u:p@h:5432/db?sslmode=disable")
+	if err != nil {
+		t.Fatalf("pgxDriverURL failed: %v", err)
+	}
+	if want := "pgx5://u:p@h:5432/db?application_name=psqltoolbox&sslmode=disable"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	got, err = pgxDriverURL("postgres://u:p@h:5432/db?application_name=app&channel_binding=require")
+	if err != nil {
+		t.Fatalf("pgxDriverURL failed: %v", err)
+	}
+	if want := "pgx5://u:p@h:5432/db?application_name=app&channel_binding=require"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// Test that migrations are read from an fs.FS subdirectory in version order.
+func TestMigrateUp_FS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"db/migrations/1_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id int);")},
+		"db/migrations/1_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"db/migrations/2_add_name.up.sql":         {Data: []byte("ALTER TABLE widgets ADD name text;")},
+		"db/migrations/README.md":                 {Data: []byte("not a migration")},
+	}
+	src, err := iofs.New(fsys, "db/migrations")
+	if err != nil {
+		t.Fatalf("open source: %v", err)
+	}
+	db, err := stub.WithInstance(nil, &stub.Config{})
+	if err != nil {
+		t.Fatalf("stub driver: %v", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "stub", db)
+	if err != nil {
+		t.Fatalf("new migrate: %v", err)
+	}
+	if err := migrateUp(context.Background(), m); err != nil {
+		t.Fatalf("migrateUp failed: %v", err)
+	}
+
+	s := db.(*stub.Stub)
+	want := []string{"CREATE TABLE widgets (id int);", "ALTER TABLE widgets ADD name text;"}
+	if s.CurrentVersion != 2 || !slices.Equal(s.MigrationSequence, want) {
+		t.Fatalf("got version %d and migrations %q, want 2 and %q", s.CurrentVersion, s.MigrationSequence, want)
+	}
+}
+
+func TestMigrateUpFS_Empty(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations":           {Mode: fs.ModeDir},
+		"migrations/notes.txt": {Data: []byte("nothing here")},
+	}
+	err := MigrateUpFS(context.Background(), "postgres://u:secret@h/db", fsys, "migrations")
+	if !errors.Is(err, ErrNoMigrationFiles) {
+		t.Fatalf("expected ErrNoMigrationFiles, got %v", err)
+	}
+
+	err = MigrateUpFS(context.Background(), "postgres://u:secret@h/db", fsys, "missing")
+	if err == nil || errors.Is(err, ErrNoMigrationFiles) {
+		t.Fatalf("expected a read error for a missing directory, got %v", err)
+	}
+}
@@ -0,0 +1,209 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ListTables returns the names of the tables in schema, sorted. It uses the
+// same catalog query as the drop phase of DropTablesAndMigrate.
+func ListTables(ctx context.Context, conn Querier, schema string) ([]string, error) {
+	return listTables(ctx, conn, schema)
+}
+
+// RowCounts returns the approximate number of rows in each table in schema,
+// taken from the planner statistics in pg_class.reltuples. It is fast but only
+// as fresh as the last VACUUM or ANALYZE; tables that have never been
+// analyzed report -1. Use ExactRowCounts when precision matters.
+func RowCounts(ctx context.Context, conn Querier, schema string) (map[string]int64, error) {
+	return rowCounts(ctx, conn, schema)
+}
+
+// ExactRowCounts returns the number of rows in each table in schema by
+// running count(*) on every table. It is exact but scans each table in full.
+func ExactRowCounts(ctx context.Context, conn Querier, schema string) (map[string]int64, error) {
+	return exactRowCounts(ctx, conn, schema)
+}
+
+func listTables(ctx context.Context, conn dbConn, schema string) ([]string, error) {
+	objs, err := listObjects(ctx, conn, tableCategory, schema)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(objs))
+	for i, o := range objs {
+		names[i] = o.Name
+	}
+	return names, nil
+}
+
+const rowCountsSQL = `
+SELECT c.relname, c.reltuples::bigint
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = $1 AND c.relkind IN ('r', 'p')
+ORDER BY c.relname`
+
+func rowCounts(ctx context.Context, conn dbConn, schema string) (map[string]int64, error) {
+	rows, err := conn.Query(ctx, rowCountsSQL, schema)
+	if err != nil {
+		return nil, fmt.Errorf("row counts: %w", err)
+	}
+	counts := make(map[string]int64)
+	var (
+		name  string
+		count int64
+	)
+	_, err = pgx.ForEachRow(rows, []any{&name, &count}, func() error {
+		counts[name] = count
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("row counts: %w", err)
+	}
+	return counts, nil
+}
+
+func exactRowCounts(ctx context.Context, conn dbConn, schema string) (map[string]int64, error) {
+	tables, err := listTables(ctx, conn, schema)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(tables))
+	for _, tbl := range tables {
+		n, err := scalar[int64](ctx, conn, "SELECT count(*) FROM "+pgx.Identifier{schema, tbl}.Sanitize())
+		if err != nil {
+			return nil, fmt.Errorf("count rows in %s: %w", tbl, err)
+		}
+		counts[tbl] = n
+	}
+	return counts, nil
+}
+
+// ErrTableNotFound is returned by DescribeTable when the table does not exist.
+var ErrTableNotFound = errors.New("table not found")
+
+// TableInfo describes a table's columns and keys, as returned by
+// DescribeTable.
+type TableInfo struct {
+	Schema      string
+	Name        string
+	Columns     []ColumnInfo // in table order
+	PrimaryKey  []string     // column names in key order; empty without a primary key
+	ForeignKeys []ForeignKey // sorted by constraint name
+}
+
+// ColumnInfo describes one column of a table.
+type ColumnInfo struct {
+	Name     string
+	Type     string // as printed by format_type, e.g. "character varying(255)"
+	Nullable bool
+	Default  string // the default expression, or "" when there is none
+}
+
+// ForeignKey describes a foreign key constraint. Columns[i] references
+// RefColumns[i].
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefSchema  string
+	RefTable   string
+	RefColumns []string
+}
+
+// DescribeTable returns the columns, primary key and foreign keys of
+// schema.table from pg_catalog, e.g. to compare the schema left by migrations
+// against what is expected. A missing table yields ErrTableNotFound.
+func DescribeTable(ctx context.Context, conn Querier, schema, table string) (*TableInfo, error) {
+	return describeTable(ctx, conn, schema, table)
+}
+
+const describeColumnsSQL = `
+SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull,
+       COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE n.nspname = $1 AND c.relname = $2 AND c.relkind IN ('r', 'p')
+  AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY a.attnum`
+
+const describePrimaryKeySQL = `
+SELECT a.attname
+FROM pg_constraint con
+JOIN pg_class c ON c.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey) WITH ORDINALITY AS k(attnum, ord)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+WHERE n.nspname = $1 AND c.relname = $2 AND con.contype = 'p'
+ORDER BY k.ord`
+
+// describeForeignKeysSQL returns one row per referencing column, ordered so
+// that the rows of each constraint are adjacent and in key order.
+const describeForeignKeysSQL = `
+SELECT con.conname, a.attname, rn.nspname, rc.relname, ra.attname
+FROM pg_constraint con
+JOIN pg_class c ON c.oid = con.conrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+JOIN pg_class rc ON rc.oid = con.confrelid
+JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refattnum, ord)
+JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refattnum
+WHERE n.nspname = $1 AND c.relname = $2 AND con.contype = 'f'
+ORDER BY con.conname, k.ord`
+
+func describeTable(ctx context.Context, conn dbConn, schema, table string) (*TableInfo, error) {
+	name := pgx.Identifier{schema, table}.Sanitize()
+	info := &TableInfo{Schema: schema, Name: table}
+
+	rows, err := conn.Query(ctx, describeColumnsSQL, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: columns: %w", name, err)
+	}
+	info.Columns, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (ColumnInfo, error) {
+		var c ColumnInfo
+		err := row.Scan(&c.Name, &c.Type, &c.Nullable, &c.Default)
+		return c, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: columns: %w", name, err)
+	}
+	if len(info.Columns) == 0 {
+		return nil, fmt.Errorf("describe %s: %w", name, ErrTableNotFound)
+	}
+
+	rows, err = conn.Query(ctx, describePrimaryKeySQL, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: primary key: %w", name, err)
+	}
+	info.PrimaryKey, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: primary key: %w", name, err)
+	}
+
+	rows, err = conn.Query(ctx, describeForeignKeysSQL, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: foreign keys: %w", name, err)
+	}
+	var conName, col, refSchema, refTable, refCol string
+	_, err = pgx.ForEachRow(rows, []any{&conName, &col, &refSchema, &refTable, &refCol}, func() error {
+		n := len(info.ForeignKeys)
+		if n == 0 || info.ForeignKeys[n-1].Name != conName {
+			info.ForeignKeys = append(info.ForeignKeys, ForeignKey{Name: conName, RefSchema: refSchema, RefTable: refTable})
+			n++
+		}
+		fk := &info.ForeignKeys[n-1]
+		fk.Columns = append(fk.Columns, col)
+		fk.RefColumns = append(fk.RefColumns, refCol)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("describe %s: foreign keys: %w", name, err)
+	}
+	return info, nil
+}
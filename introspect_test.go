@@ -0,0 +1,119 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestListTablesAndRowCounts(t *testing.T) {
+	catalog := catalogRows(
+		dbObject{Kind: "TABLE", Schema: "app", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "app", Name: "users"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "other"},
+	)
+	conn := &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+		switch sql {
+		case rowCountsSQL:
+			return [][]any{{"orders", int64(1200)}, {"users", int64(-1)}}
+		case `SELECT count(*) FROM "app"."orders"`:
+			return [][]any{{int64(1234)}}
+		case `SELECT count(*) FROM "app"."users"`:
+			return [][]any{{int64(5)}}
+		}
+		return catalog(sql, args)
+	}}
+	ctx := context.Background()
+
+	tables, err := listTables(ctx, conn, "app")
+	if err != nil {
+		t.Fatalf("listTables: %v", err)
+	}
+	if !slices.Equal(tables, []string{"orders", "users"}) {
+		t.Fatalf("unexpected tables: %v", tables)
+	}
+
+	approx, err := rowCounts(ctx, conn, "app")
+	if err != nil {
+		t.Fatalf("rowCounts: %v", err)
+	}
+	if want := map[string]int64{"orders": 1200, "users": -1}; !maps.Equal(approx, want) {
+		t.Fatalf("approximate counts %v, want %v", approx, want)
+	}
+
+	exact, err := exactRowCounts(ctx, conn, "app")
+	if err != nil {
+		t.Fatalf("exactRowCounts: %v", err)
+	}
+	if want := map[string]int64{"orders": 1234, "users": 5}; !maps.Equal(exact, want) {
+		t.Fatalf("exact counts %v, want %v", exact, want)
+	}
+}
+
+// Test DescribeTable against catalog rows for a table created as:
+//
+//	CREATE TABLE app.order_items (
+//	    order_id bigint REFERENCES app.orders (id),
+//	    line int,
+//	    sku text NOT NULL DEFAULT 'unknown',
+//	    warehouse text, bin text,
+//	    PRIMARY KEY (order_id, line),
+//	    FOREIGN KEY (warehouse, bin) REFERENCES inventory.bins (warehouse, code)
+//	);
+func TestDescribeTable(t *testing.T) {
+	conn := &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+		if args[0] != "app" || args[1] != "order_items" {
+			return nil
+		}
+		switch sql {
+		case describeColumnsSQL:
+			return [][]any{
+				{"order_id", "bigint", false, ""},
+				{"line", "integer", false, ""},
+				{"sku", "text", false, "'unknown'::text"},
+				{"warehouse", "text", true, ""},
+				{"bin", "text", true, ""},
+			}
+		case describePrimaryKeySQL:
+			return [][]any{{"order_id"}, {"line"}}
+		case describeForeignKeysSQL:
+			return [][]any{
+				{"order_items_order_id_fkey", "order_id", "app", "orders", "id"},
+				{"order_items_warehouse_bin_fkey", "warehouse", "inventory", "bins", "warehouse"},
+				{"order_items_warehouse_bin_fkey", "bin", "inventory", "bins", "code"},
+			}
+		}
+		return nil
+	}}
+
+	info, err := describeTable(context.Background(), conn, "app", "order_items")
+	if err != nil {
+		t.Fatalf("describeTable: %v", err)
+	}
+	want := &TableInfo{
+		Schema: "app",
+		Name:   "order_items",
+		Columns: []ColumnInfo{
+			{Name: "order_id", Type: "bigint"},
+			{Name: "line", Type: "integer"},
+			{Name: "sku", Type: "text", Default: "'unknown'::text"},
+			{Name: "warehouse", Type: "text", Nullable: true},
+			{Name: "bin", Type: "text", Nullable: true},
+		},
+		PrimaryKey: []string{"order_id", "line"},
+		ForeignKeys: []ForeignKey{
+			{Name: "order_items_order_id_fkey", Columns: []string{"order_id"}, RefSchema: "app", RefTable: "orders", RefColumns: []string{"id"}},
+			{Name: "order_items_warehouse_bin_fkey", Columns: []string{"warehouse", "bin"}, RefSchema: "inventory", RefTable: "bins", RefColumns: []string{"warehouse", "code"}},
+		},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Fatalf("got %+v\nwant %+v", info, want)
+	}
+
+	if _, err := describeTable(context.Background(), conn, "app", "missing"); !errors.Is(err, ErrTableNotFound) {
+		t.Fatalf("expected ErrTableNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package psqltoolbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DumpMetadata records the provenance of a dump. PgDumpToFileWithOptions
+// writes it as JSON next to the dump when PgDumpOptions.WriteMetadata is set.
+type DumpMetadata struct {
+	// Source is the dumped database's URL with the password redacted.
+	Source   string `json:"source"`
+	Host     string `json:"host"`
+	Database string `json:"database"`
+
+	ServerVersion string `json:"server_version"`
+	PgDumpVersion string `json:"pg_dump_version"`
+
+	// StartedAt is when the dump began.
+	StartedAt time.Time `json:"started_at"`
+	// SizeBytes is the size of the dump file, or the total size of the
+	// files in a directory-format dump.
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// MetadataPath returns the path of the metadata sidecar for outFile.
+func MetadataPath(outFile string) string {
+	return outFile + ".meta.json"
+}
+
+// writeDumpMetadata writes the DumpMetadata sidecar for the dump of cfg in
+// outFile, which started at start. Its errors wrap ErrMetadataFailed.
+func writeDumpMetadata(ctx context.Context, dbURL string, cfg *ConnConfig, opts PgDumpOptions, outFile string, start time.Time, connect connector) error {
+	bin, err := toolBinary(opts.Runner, opts.Binary, "pg_dump", nil)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+	clientVersion, err := pgDumpVersion(ctx, opts.Runner, bin)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+	serverVersion, err := serverVersionAt(ctx, dbURL, connect)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+	size, err := dumpSize(outFile)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+
+	meta := DumpMetadata{
+		Source:        cfg.Redacted(),
+		Host:          cfg.Host,
+		Database:      cfg.Database,
+		ServerVersion: serverVersion,
+		PgDumpVersion: clientVersion,
+		StartedAt:     start.UTC(),
+		SizeBytes:     size,
+	}
+	b, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+	if err := os.WriteFile(MetadataPath(outFile), append(b, '\n'), 0o644); err != nil {
+		return fmt.Errorf("%w: %w", ErrMetadataFailed, err)
+	}
+	return nil
+}
+
+// serverVersionAt returns the server_version of the database at dbURL.
+func serverVersionAt(ctx context.Context, dbURL string, connect connector) (version string, err error) {
+	err = withConn(ctx, dbURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		version, err = serverVersion(ctx, conn)
+		return err
+	})
+	return version, err
+}
+
+// dumpSize returns the size of the file at path, or the total size of the
+// files under it if it is a directory.
+func dumpSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += fi.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,408 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	migratedb "github.com/golang-migrate/migrate/v4/database"
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultMigrateTimeout bounds each invocation of the migrate CLI unless the
+// caller sets a different timeout.
+const DefaultMigrateTimeout = 5 * time.Minute
+
+// ErrNoMigrations is returned by MigrationVersion when no migration has been
+// applied yet, either because the schema_migrations table does not exist or
+// because it is empty.
+var ErrNoMigrations = errors.New("no migrations applied")
+
+// ErrMigrationLocked is returned when the migrate CLI, or golang-migrate run
+// in-process, could not take the advisory lock it holds while migrating,
+// typically because another process is migrating the same database at the
+// same time. Set MigrateOptions.LockRetries or ResetOptions.MigrateLockRetries
+// to retry the CLI.
+var ErrMigrationLocked = errors.New("migration lock not acquired")
+
+// DefaultMigrateLockRetryDelay is the delay before the first retry of a
+// migrate command that failed with ErrMigrationLocked, unless the caller sets
+// a different one. It doubles with every further retry.
+const DefaultMigrateLockRetryDelay = time.Second
+
+// migrateLockMessages are the messages golang-migrate prints when it cannot
+// take its lock: the texts of migrate.ErrLockTimeout, database.ErrLocked,
+// migrate.ErrLocked and the postgres driver's failed lock query.
+var migrateLockMessages = []string{
+	"can't acquire database lock",
+	"can't acquire lock",
+	"database locked",
+	"try lock failed",
+}
+
+// ErrMigrationDirty is returned when the migrate CLI refuses to run because a
+// previous migration failed partway and left the database marked dirty. Use
+// MigrateForce to clear the flag once the schema has been repaired.
+var ErrMigrationDirty = errors.New("database migration state is dirty")
+
+// MigrateOptions controls how the migrate CLI is run by
+// MigrateDownWithOptions, MigrateToVersionWithOptions and
+// MigrateForceWithOptions. The zero value matches the plain functions.
+type MigrateOptions struct {
+	// Binary is the path to the migrate executable, e.g. when golang-migrate
+	// is installed under another name to avoid clashing with other tools.
+	// When empty, "migrate" is resolved from PATH. It is checked before
+	// anything runs, failing with ErrBinaryNotFound.
+	Binary string
+
+	// Runner runs migrate; defaults to ExecRunner. A custom Runner is given
+	// Binary, or "migrate", without looking it up in PATH.
+	Runner CommandRunner
+
+	// Timeout bounds each run of the command. Defaults to
+	// DefaultMigrateTimeout when zero.
+	Timeout time.Duration
+
+	// LockRetries reruns the command up to this many more times when it
+	// fails with ErrMigrationLocked, e.g. when several replicas migrate on
+	// startup. Other failures, such as an error in a migration's SQL, are
+	// never retried.
+	LockRetries int
+	// LockRetryDelay is the delay before the first retry, doubled for each
+	// later one with some jitter. Defaults to DefaultMigrateLockRetryDelay.
+	LockRetryDelay time.Duration
+
+	// Source is a golang-migrate source URL, such as s3://bucket/migrations
+	// or github://owner/repo/migrations, passed as -source in place of
+	// -path. The migrations path must then be empty. The migrate binary
+	// must be built with the source driver the URL names.
+	Source string
+}
+
+// MigrateDown rolls back the last steps migrations by running `migrate down N`.
+func MigrateDown(ctx context.Context, dbURL, migrationsPath string, steps int) error {
+	return MigrateDownWithOptions(ctx, dbURL, migrationsPath, steps, MigrateOptions{})
+}
+
+// MigrateDownWithOptions is like MigrateDown but lets the caller choose the
+// migrate binary and timeout through opts.
+func MigrateDownWithOptions(ctx context.Context, dbURL, migrationsPath string, steps int, opts MigrateOptions) error {
+	if steps <= 0 {
+		return fmt.Errorf("migrate down: steps must be positive, got %d", steps)
+	}
+	return runMigrate(ctx, opts, dbURL, migrationsPath, "down", strconv.Itoa(steps))
+}
+
+// MigrateToVersion migrates up or down to version by running `migrate goto V`.
+func MigrateToVersion(ctx context.Context, dbURL, migrationsPath string, version uint) error {
+	return MigrateToVersionWithOptions(ctx, dbURL, migrationsPath, version, MigrateOptions{})
+}
+
+// MigrateToVersionWithOptions is like MigrateToVersion but lets the caller
+// choose the migrate binary and timeout through opts.
+func MigrateToVersionWithOptions(ctx context.Context, dbURL, migrationsPath string, version uint, opts MigrateOptions) error {
+	return runMigrate(ctx, opts, dbURL, migrationsPath, "goto", strconv.FormatUint(uint64(version), 10))
+}
+
+// MigrateForce sets the recorded migration version to version and clears the
+// dirty flag by running `migrate force V`. It does not run any migrations, so
+// the schema must already match version.
+func MigrateForce(ctx context.Context, dbURL, migrationsPath string, version int) error {
+	return MigrateForceWithOptions(ctx, dbURL, migrationsPath, version, MigrateOptions{})
+}
+
+// MigrateForceWithOptions is like MigrateForce but lets the caller choose the
+// migrate binary and timeout through opts.
+func MigrateForceWithOptions(ctx context.Context, dbURL, migrationsPath string, version int, opts MigrateOptions) error {
+	if version < 0 {
+		return fmt.Errorf("migrate force: version must be non-negative, got %d", version)
+	}
+	if err := runMigrate(ctx, opts, dbURL, migrationsPath, "force", strconv.Itoa(version)); err != nil {
+		return fmt.Errorf("force migration version %d: %w", version, err)
+	}
+	return nil
+}
+
+// MigrationVersion reports the migration version recorded by golang-migrate in
+// the schema_migrations table and whether it is dirty. The table is queried
+// directly rather than parsing CLI output; migrationsPath is accepted for
+// symmetry with the other migrate helpers and is not read. ErrNoMigrations is
+// returned when nothing has been applied yet.
+func MigrationVersion(ctx context.Context, dbURL, migrationsPath string) (version uint, dirty bool, err error) {
+	err = withConn(ctx, dbURL, 0, pgxConnect, func(ctx context.Context, conn closableConn) error {
+		version, dirty, err = migrationVersion(ctx, conn)
+		return err
+	})
+	return version, dirty, err
+}
+
+// MigrationVersionConn is like MigrationVersion but reads the version over an
+// existing connection, which the caller keeps ownership of.
+func MigrationVersionConn(ctx context.Context, conn Querier) (version uint, dirty bool, err error) {
+	return migrationVersion(ctx, conn)
+}
+
+// WaitForMigrationVersion polls the database at dbURL until golang-migrate
+// has recorded target or a later version that is not dirty, for services
+// that must not start before another service's migrations have run. A
+// missing schema_migrations table, or one with no version recorded, counts
+// as version 0: it satisfies a target of 0 and otherwise the wait goes on.
+// Polling works as in WaitForDatabaseReady: on timeout the last version seen
+// or connection error is returned, and cancelling ctx stops the wait.
+func WaitForMigrationVersion(ctx context.Context, dbURL string, target uint, interval, timeout time.Duration) error {
+	return waitForReady(ctx, interval, timeout, false, func(ctx context.Context) error {
+		return migrationVersionProbe(ctx, dbURL, target, pgxConnect)
+	})
+}
+
+// migrationVersionProbe reports whether the database at dbURL has reached
+// target, returning an error saying why not.
+func migrationVersionProbe(ctx context.Context, dbURL string, target uint, connect connector) error {
+	return withConn(ctx, dbURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		version, dirty, err := migrationVersion(ctx, conn)
+		switch {
+		case errors.Is(err, ErrNoMigrations):
+			if target == 0 {
+				return nil
+			}
+			return fmt.Errorf("waiting for migration version %d: %w", target, err)
+		case err != nil:
+			return err
+		case dirty:
+			return fmt.Errorf("waiting for migration version %d: version %d: %w", target, version, ErrMigrationDirty)
+		case version < target:
+			return fmt.Errorf("waiting for migration version %d: at version %d: %w", target, version, errNotReady)
+		}
+		return nil
+	})
+}
+
+// ClearMigrationLock releases the advisory lock golang-migrate takes on the
+// database conn is connected to while migrating, for recovery when a stuck
+// migrate process blocks every later run. It reports whether the lock was
+// held. Advisory locks belong to a session, so the lock is unlocked if conn's
+// own session holds it and otherwise released by terminating the session
+// that does, which needs the rights described for TerminateConnections. The
+// lock key is derived as golang-migrate does, from the database name, the
+// current schema and the schema_migrations table. Unlike MigrateForce it
+// leaves the recorded version alone.
+func ClearMigrationLock(ctx context.Context, conn Querier) (held bool, err error) {
+	return clearMigrationLock(ctx, conn)
+}
+
+// migrationLockSessionsSQL ends the other sessions holding advisory lock $1
+// in the current database. A bigint key shows in pg_locks split into classid
+// (high half) and objid (low half); golang-migrate's keys fit the low half.
+const migrationLockSessionsSQL = `
+SELECT pg_terminate_backend(l.pid)
+FROM pg_locks l
+JOIN pg_database d ON d.oid = l.database
+WHERE l.locktype = 'advisory' AND l.granted
+  AND d.datname = current_database()
+  AND l.classid = 0 AND l.objid = $1::bigint::oid AND l.objsubid = 1
+  AND l.pid <> pg_backend_pid()`
+
+func clearMigrationLock(ctx context.Context, conn dbConn) (bool, error) {
+	key, err := migrationLockKey(ctx, conn)
+	if err != nil {
+		return false, fmt.Errorf("clear migration lock: %w", err)
+	}
+	// pg_advisory_unlock warns but returns false when the lock is not ours
+	unlocked, err := scalar[bool](ctx, conn, `SELECT pg_advisory_unlock($1)`, key)
+	if err != nil {
+		return false, fmt.Errorf("clear migration lock: unlock: %w", err)
+	}
+	rows, err := conn.Query(ctx, migrationLockSessionsSQL, key)
+	if err != nil {
+		return false, fmt.Errorf("clear migration lock: terminate holder: %w", err)
+	}
+	terminated, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return false, fmt.Errorf("clear migration lock: terminate holder: %w", err)
+	}
+	return unlocked || slices.Contains(terminated, true), nil
+}
+
+// migrationLockKey returns the advisory lock key golang-migrate's postgres
+// and pgx drivers use for the database and schema conn is connected to.
+func migrationLockKey(ctx context.Context, conn dbConn) (int64, error) {
+	dbName, err := scalar[string](ctx, conn, `SELECT current_database()`)
+	if err != nil {
+		return 0, fmt.Errorf("current database: %w", err)
+	}
+	schema, err := scalar[string](ctx, conn, `SELECT current_schema()`)
+	if err != nil {
+		return 0, fmt.Errorf("current schema: %w", err)
+	}
+	id, err := migratedb.GenerateAdvisoryLockId(dbName, schema, "schema_migrations")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(id, 10, 64)
+}
+
+// migrationVersion implements MigrationVersion against any dbConn.
+func migrationVersion(ctx context.Context, conn dbConn) (uint, bool, error) {
+	exists, err := scalar[bool](ctx, conn, `SELECT to_regclass('schema_migrations') IS NOT NULL`)
+	if err != nil {
+		return 0, false, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if !exists {
+		return 0, false, ErrNoMigrations
+	}
+
+	rows, err := conn.Query(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if err != nil {
+		return 0, false, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	type versionRow struct {
+		Version int64
+		Dirty   bool
+	}
+	row, err := pgx.CollectExactlyOneRow(rows, func(r pgx.CollectableRow) (versionRow, error) {
+		var v versionRow
+		err := r.Scan(&v.Version, &v.Dirty)
+		return v, err
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, ErrNoMigrations
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	if row.Version < 0 {
+		return 0, false, ErrNoMigrations
+	}
+	return uint(row.Version), row.Dirty, nil
+}
+
+// checkMigrationsDir verifies that migrationsPath is a directory holding at
+// least one *.up.sql file, so a mistyped path is reported before a reset drops
+// anything. An empty directory yields ErrNoMigrationFiles.
+func checkMigrationsDir(migrationsPath string) error {
+	fi, err := os.Stat(migrationsPath)
+	if err != nil {
+		return fmt.Errorf("migrations path: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("migrations path %s is not a directory", migrationsPath)
+	}
+	ups, err := filepath.Glob(filepath.Join(migrationsPath, "*.up.sql"))
+	if err != nil {
+		return fmt.Errorf("migrations path: %w", err)
+	}
+	if len(ups) == 0 {
+		return fmt.Errorf("%w in %s: expected *.up.sql files", ErrNoMigrationFiles, migrationsPath)
+	}
+	return nil
+}
+
+// migrateDatabaseArg returns the -database argument for the migrate CLI with
+// the password removed from dbURL, so it cannot show up in process listings or
+// in migrate's own output, and the environment that passes the password as
+// PGPASSWORD instead and PGAPPNAME as for toolEnv. A dbURL that does not parse
+// is returned unchanged, with a nil env meaning inherit.
+func migrateDatabaseArg(dbURL string) (arg string, env []string) {
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL, nil
+	}
+	env = append(os.Environ(), defaultAppName(u.Query().Has("application_name"))...)
+	if u.User == nil {
+		return dbURL, env
+	}
+	password, ok := u.User.Password()
+	if !ok {
+		return dbURL, env
+	}
+	u.User = url.User(u.User.Username())
+	return u.String(), append(env, "PGPASSWORD="+password)
+}
+
+// migrateSourceArgs returns the migrate flags naming where migrations are
+// read from: -path for a local directory or -source for a source URL. Exactly
+// one of the two must be given.
+func migrateSourceArgs(migrationsPath, source string) ([]string, error) {
+	switch {
+	case migrationsPath != "" && source != "":
+		return nil, errors.New("migrate: give a migrations path or a source URL, not both")
+	case source != "":
+		return []string{"-source", source}, nil
+	case migrationsPath != "":
+		return []string{"-path", migrationsPath}, nil
+	}
+	return nil, errors.New("migrate: a migrations path or a source URL is required")
+}
+
+// runMigrate runs the migrate CLI (opts.Binary, or "migrate" from PATH)
+// against dbURL with the given subcommand and arguments, retrying lock
+// failures as opts asks.
+func runMigrate(ctx context.Context, opts MigrateOptions, dbURL, migrationsPath string, args ...string) error {
+	if opts.LockRetries <= 0 {
+		return runMigrateOnce(ctx, opts, dbURL, migrationsPath, args...)
+	}
+	delay := opts.LockRetryDelay
+	if delay == 0 {
+		delay = DefaultMigrateLockRetryDelay
+	}
+	isLocked := func(err error) bool { return errors.Is(err, ErrMigrationLocked) }
+	return retryIf(ctx, opts.LockRetries+1, delay, isLocked, func(ctx context.Context) error {
+		return runMigrateOnce(ctx, opts, dbURL, migrationsPath, args...)
+	})
+}
+
+// runMigrateOnce runs the migrate CLI once. A zero opts.Timeout means
+// DefaultMigrateTimeout. Cancelling ctx kills migrate and the error wraps
+// ctx.Err(), so a caller's cancellation matches context.Canceled; only when
+// the timeout itself fires does it match context.DeadlineExceeded alone.
+func runMigrateOnce(ctx context.Context, opts MigrateOptions, dbURL, migrationsPath string, args ...string) error {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultMigrateTimeout
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("%w: migrate %s not started: %w", ErrMigrateFailed, args[0], err)
+	}
+	sourceArgs, err := migrateSourceArgs(migrationsPath, opts.Source)
+	if err != nil {
+		return err
+	}
+	bin, err := toolBinary(opts.Runner, opts.Binary, "migrate", ErrMigrateFailed)
+	if err != nil {
+		return err
+	}
+	mctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	databaseArg, env := migrateDatabaseArg(dbURL)
+	cmdArgs := append([]string{"-database", databaseArg}, sourceArgs...)
+	cmdArgs = append(cmdArgs, args...)
+	cmd := toolCommand{runner: opts.Runner, bin: bin, args: cmdArgs, env: env}
+	if err := runTool(mctx, cmd, "migrate "+args[0], ErrMigrateFailed, dbURL, opts.Source); err != nil {
+		// runTool wraps mctx.Err(), which is the parent's error whenever
+		// the parent ended first
+		if ctx.Err() != nil {
+			return fmt.Errorf("migrate %s stopped: %w", args[0], err)
+		}
+		if errors.Is(mctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("migrate %s timed out after %s: %w", args[0], timeout, err)
+		}
+		if strings.Contains(err.Error(), "Dirty database version") {
+			return fmt.Errorf("%w: %w", ErrMigrationDirty, err)
+		}
+		for _, msg := range migrateLockMessages {
+			if strings.Contains(err.Error(), msg) {
+				return fmt.Errorf("%w: %w", ErrMigrationLocked, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,351 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestMigrateDown(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	withPathPrepended(dir, func() {
+		if err := MigrateDown(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 2); err != nil {
+			t.Fatalf("MigrateDown failed: %v", err)
+		}
+		want := []string{"-database", "postgres://u@h:1234/db", "-path", "/migrations", "down", "2"}
+		if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+			t.Fatalf("got args %v, want %v", got, want)
+		}
+	})
+
+	if err := MigrateDown(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 0); err == nil {
+		t.Fatalf("expected error for non-positive steps")
+	}
+}
+
+func TestMigrateToVersion(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	withPathPrepended(dir, func() {
+		if err := MigrateToVersion(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 20240101); err != nil {
+			t.Fatalf("MigrateToVersion failed: %v", err)
+		}
+		want := []string{"-database", "postgres://u@h:1234/db", "-path", "/migrations", "goto", "20240101"}
+		if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+			t.Fatalf("got args %v, want %v", got, want)
+		}
+	})
+}
+
+// Test that an explicit migrate binary is used instead of PATH, and that a
+// missing one is reported before anything runs.
+func TestMigrateWithOptions_Binary(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "golang-migrate")
+	opts := MigrateOptions{Binary: filepath.Join(dir, "golang-migrate")}
+
+	if err := MigrateToVersionWithOptions(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 3, opts); err != nil {
+		t.Fatalf("MigrateToVersionWithOptions failed: %v", err)
+	}
+	want := []string{"-database", "postgres://u@h:1234/db", "-path", "/migrations", "goto", "3"}
+	if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+		t.Fatalf("got args %v, want %v", got, want)
+	}
+
+	opts.Binary = filepath.Join(dir, "missing")
+	err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 1, opts)
+	if !errors.Is(err, ErrBinaryNotFound) || !strings.Contains(err.Error(), opts.Binary) {
+		t.Fatalf("expected ErrBinaryNotFound naming %s, got %v", opts.Binary, err)
+	}
+}
+
+// Test that a source URL is passed as -source instead of -path, and that
+// exactly one of the two is required.
+func TestMigrateWithOptions_Source(t *testing.T) {
+	runner := &fakeRunner{}
+	opts := MigrateOptions{Runner: runner, Source: "s3://bucket/migrations"}
+
+	if err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", "", 1, opts); err != nil {
+		t.Fatalf("MigrateDownWithOptions failed: %v", err)
+	}
+	want := []string{"-database", "postgres://u@h:1234/db", "-source", "s3://bucket/migrations", "down", "1"}
+	if len(runner.calls) != 1 || !slices.Equal(runner.calls[0].args, want) {
+		t.Fatalf("got calls %v, want args %v", runner.calls, want)
+	}
+
+	if err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 1, opts); err == nil || !strings.Contains(err.Error(), "not both") {
+		t.Fatalf("expected an error for both a path and a source URL, got %v", err)
+	}
+	opts.Source = ""
+	if err := MigrateDownWithOptions(context.Background(), "postgres://u:p@h:1234/db", "", 1, opts); err == nil || !strings.Contains(err.Error(), "required") {
+		t.Fatalf("expected an error for neither a path nor a source URL, got %v", err)
+	}
+	if len(runner.calls) != 1 {
+		t.Fatalf("expected migrate not to run for invalid sources, got %d calls", len(runner.calls))
+	}
+}
+
+// Test that migrate's dirty-state failure is reported as ErrMigrationDirty.
+func TestMigrateDown_Dirty(t *testing.T) {
+	tmpdir := t.TempDir()
+	script := "#!/usr/bin/env bash\necho 'error: Dirty database version 3. Fix and force version.' >&2\nexit 1\n"
+	if err := os.WriteFile(filepath.Join(tmpdir, "migrate"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake migrate: %v", err)
+	}
+	withPathPrepended(tmpdir, func() {
+		err := MigrateDown(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 1)
+		if !errors.Is(err, ErrMigrationDirty) {
+			t.Fatalf("expected ErrMigrationDirty, got %v", err)
+		}
+	})
+}
+
+// Test that the password reaches migrate through PGPASSWORD rather than its
+// arguments.
+func TestMigrate_PasswordNotInArgs(t *testing.T) {
+	tmpdir := t.TempDir()
+	argsFile := filepath.Join(tmpdir, "args")
+	script := `#!/usr/bin/env bash
+printf '%s\n' "$@" "PGPASSWORD=$PGPASSWORD" > "` + argsFile + `"
+`
+	if err := os.WriteFile(filepath.Join(tmpdir, "migrate"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake migrate: %v", err)
+	}
+	withPathPrepended(tmpdir, func() {
+		dbURL := "postgres://u:s3cr%40t@h:1234/db?sslmode=disable"
+		if err := MigrateDown(context.Background(), dbURL, "/migrations", 1); err != nil {
+			t.Fatalf("MigrateDown failed: %v", err)
+		}
+	})
+	got := readArgs(t, argsFile)
+	for _, arg := range got[:len(got)-1] {
+		if strings.Contains(arg, "s3cr") {
+			t.Fatalf("password leaked into migrate arguments: %v", got)
+		}
+	}
+	if db, _ := flagValue(got, "-database"); db != "postgres://u@h:1234/db?sslmode=disable" {
+		t.Fatalf("unexpected -database argument %q", db)
+	}
+	if env := got[len(got)-1]; env != "PGPASSWORD=s3cr@t" {
+		t.Fatalf("expected decoded password in PGPASSWORD, got %q", env)
+	}
+}
+
+func TestMigrateForce(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	withPathPrepended(dir, func() {
+		if err := MigrateForce(context.Background(), "postgres://u:p@h:1234/db", "/migrations", 3); err != nil {
+			t.Fatalf("MigrateForce failed: %v", err)
+		}
+		want := []string{"-database", "postgres://u@h:1234/db", "-path", "/migrations", "force", "3"}
+		if got := readArgs(t, argsFile); !slices.Equal(got, want) {
+			t.Fatalf("got args %v, want %v", got, want)
+		}
+
+		if err := MigrateForce(context.Background(), "postgres://u:p@h:1234/db", "/migrations", -5); err == nil {
+			t.Fatalf("expected error for negative version")
+		}
+	})
+}
+
+// Test that WaitForMigrationVersion keeps polling through a missing table, an
+// older version and a dirty target until the target is recorded cleanly.
+func TestWaitForMigrationVersion(t *testing.T) {
+	const existsSQL = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	const versionSQL = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+	states := []map[string][][]any{
+		{existsSQL: {{false}}},
+		{existsSQL: {{true}}, versionSQL: {{int64(3), false}}},
+		{existsSQL: {{true}}, versionSQL: {{int64(5), true}}},
+		{existsSQL: {{true}}, versionSQL: {{int64(6), false}}},
+	}
+	polls := 0
+	connect := func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+		rows := states[min(polls, len(states)-1)]
+		polls++
+		return &fakeConn{rows: rows}, nil
+	}
+	probe := func(ctx context.Context) error {
+		return migrationVersionProbe(ctx, "postgres://u:p@h:5432/db", 5, connect)
+	}
+
+	if err := waitForReady(context.Background(), 10*time.Millisecond, 5*time.Second, false, probe); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if polls != 4 {
+		t.Fatalf("expected 4 polls, got %d", polls)
+	}
+
+	// a version that never arrives reports where the database got to
+	err := waitForReady(context.Background(), 10*time.Millisecond, 50*time.Millisecond, false, func(ctx context.Context) error {
+		return migrationVersionProbe(ctx, "postgres://u:p@h:5432/db", 9, func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+			return &fakeConn{rows: states[1]}, nil
+		})
+	})
+	if !errors.Is(err, errNotReady) || !strings.Contains(err.Error(), "at version 3") {
+		t.Fatalf("expected a not-ready error naming version 3, got %v", err)
+	}
+
+	// a target of 0 is reached before any migration has run
+	polls = 0
+	if err := migrationVersionProbe(context.Background(), "postgres://u:p@h:5432/db", 0, connect); err != nil || polls != 1 {
+		t.Fatalf("expected a missing table to satisfy version 0 on the first poll, got %v after %d polls", err, polls)
+	}
+}
+
+func TestMigrationVersion(t *testing.T) {
+	const existsSQL = `SELECT to_regclass('schema_migrations') IS NOT NULL`
+	const versionSQL = `SELECT version, dirty FROM schema_migrations LIMIT 1`
+
+	cases := []struct {
+		name      string
+		rows      map[string][][]any
+		version   uint
+		dirty     bool
+		noApplied bool
+	}{
+		{"applied", map[string][][]any{existsSQL: {{true}}, versionSQL: {{int64(7), false}}}, 7, false, false},
+		{"dirty", map[string][][]any{existsSQL: {{true}}, versionSQL: {{int64(8), true}}}, 8, true, false},
+		{"no table", map[string][][]any{existsSQL: {{false}}}, 0, false, true},
+		{"empty table", map[string][][]any{existsSQL: {{true}}, versionSQL: nil}, 0, false, true},
+	}
+	for _, c := range cases {
+		version, dirty, err := migrationVersion(context.Background(), &fakeConn{rows: c.rows})
+		if c.noApplied {
+			if !errors.Is(err, ErrNoMigrations) {
+				t.Fatalf("%s: expected ErrNoMigrations, got %v", c.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.name, err)
+		}
+		if version != c.version || dirty != c.dirty {
+			t.Fatalf("%s: got version=%d dirty=%v, want %d %v", c.name, version, dirty, c.version, c.dirty)
+		}
+	}
+}
+
+// writeFlakyMigrate writes a fake migrate that fails with message on its
+// first failures runs and then succeeds, counting runs in the returned file.
+func writeFlakyMigrate(t *testing.T, failures int, message string) (bin, countFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	countFile = filepath.Join(dir, "count")
+	script := `#!/usr/bin/env bash
+n=$(( $(cat "` + countFile + `" 2>/dev/null || echo 0) + 1 ))
+echo $n > "` + countFile + `"
+if [ $n -le ` + strconv.Itoa(failures) + ` ]; then
+	echo "error: ` + message + `" >&2
+	exit 1
+fi
+`
+	bin = filepath.Join(dir, "migrate")
+	if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake migrate: %v", err)
+	}
+	return bin, countFile
+}
+
+func readCount(t *testing.T, countFile string) string {
+	t.Helper()
+	b, err := os.ReadFile(countFile)
+	if err != nil {
+		t.Fatalf("read count: %v", err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// Test that lock failures are retried until migrate succeeds, and reported as
+// ErrMigrationLocked once the retries run out.
+func TestRunMigrate_LockRetries(t *testing.T) {
+	bin, countFile := writeFlakyMigrate(t, 2, "timeout: can't acquire database lock")
+	opts := MigrateOptions{Binary: bin, LockRetries: 3, LockRetryDelay: time.Millisecond}
+	if err := runMigrate(context.Background(), opts, "postgres://u:p@h:1234/db", "/migrations", "up"); err != nil {
+		t.Fatalf("expected success after lock retries, got %v", err)
+	}
+	if n := readCount(t, countFile); n != "3" {
+		t.Fatalf("expected 3 runs, got %s", n)
+	}
+
+	bin, countFile = writeFlakyMigrate(t, 5, "try lock failed in line 0: SELECT pg_advisory_lock($1)")
+	opts = MigrateOptions{Binary: bin, LockRetries: 1, LockRetryDelay: time.Millisecond}
+	err := runMigrate(context.Background(), opts, "postgres://u:p@h:1234/db", "/migrations", "up")
+	if !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expected ErrMigrationLocked, got %v", err)
+	}
+	if n := readCount(t, countFile); n != "2" {
+		t.Fatalf("expected 2 runs, got %s", n)
+	}
+
+	// database.ErrLocked's text
+	bin, _ = writeFlakyMigrate(t, 1, "can't acquire lock")
+	err = runMigrate(context.Background(), MigrateOptions{Binary: bin}, "postgres://u:p@h:1234/db", "/migrations", "up")
+	if !errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expected ErrMigrationLocked, got %v", err)
+	}
+}
+
+// Test that a failing migration is not retried.
+func TestRunMigrate_SQLErrorNotRetried(t *testing.T) {
+	bin, countFile := writeFlakyMigrate(t, 1, `migration failed: syntax error at or near "TABL" (column 1) in line 1`)
+	opts := MigrateOptions{Binary: bin, LockRetries: 3, LockRetryDelay: time.Millisecond}
+	err := runMigrate(context.Background(), opts, "postgres://u:p@h:1234/db", "/migrations", "up")
+	if !errors.Is(err, ErrMigrateFailed) || errors.Is(err, ErrMigrationLocked) {
+		t.Fatalf("expected a plain ErrMigrateFailed, got %v", err)
+	}
+	if n := readCount(t, countFile); n != "1" {
+		t.Fatalf("expected a single run, got %s", n)
+	}
+}
+
+func TestClearMigrationLock(t *testing.T) {
+	// crc32("public\x00schema_migrations\x00app") * 1486364155, as
+	// golang-migrate computes it
+	const key = int64(1787120056)
+
+	for _, c := range []struct {
+		ownLock, otherHolder bool
+	}{{false, false}, {true, false}, {false, true}} {
+		conn := &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+			switch sql {
+			case `SELECT current_database()`:
+				return [][]any{{"app"}}
+			case `SELECT current_schema()`:
+				return [][]any{{"public"}}
+			case `SELECT pg_advisory_unlock($1)`:
+				return [][]any{{c.ownLock}}
+			case migrationLockSessionsSQL:
+				if c.otherHolder {
+					return [][]any{{true}}
+				}
+			}
+			return nil
+		}}
+		held, err := clearMigrationLock(context.Background(), conn)
+		if err != nil {
+			t.Fatalf("clearMigrationLock: %v", err)
+		}
+		if want := c.ownLock || c.otherHolder; held != want {
+			t.Fatalf("%+v: got held=%v, want %v", c, held, want)
+		}
+		keyed := 0
+		for _, q := range conn.queries {
+			if q.sql == `SELECT pg_advisory_unlock($1)` || q.sql == migrationLockSessionsSQL {
+				if q.args[0] != key {
+					t.Fatalf("%s called with key %v, want %d", q.sql, q.args[0], key)
+				}
+				keyed++
+			}
+		}
+		if keyed != 2 {
+			t.Fatalf("expected unlock and terminate queries, got %v", conn.queries)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Errors returned by Ping, wrapped around the underlying cause, so callers can
+// tell a misconfigured URL (ErrInvalidURL) from an unreachable server or a
+// failing query.
+var (
+	ErrConnectFailed = errors.New("database connection failed")
+	ErrQueryFailed   = errors.New("database query failed")
+)
+
+// closableConn is a dbConn that can be closed, such as *pgx.Conn.
+type closableConn interface {
+	dbConn
+	Close(ctx context.Context) error
+}
+
+// connector opens a connection for the parsed config.
+type connector func(ctx context.Context, cfg *pgx.ConnConfig) (closableConn, error)
+
+// pgxConnect is the connector used outside of tests.
+func pgxConnect(ctx context.Context, cfg *pgx.ConnConfig) (closableConn, error) {
+	return pgx.ConnectConfig(ctx, cfg)
+}
+
+// Ping checks that dbURL is reachable and its credentials are accepted by
+// connecting and running `SELECT 1` within timeout. Failures wrap
+// ErrInvalidURL, ErrConnectFailed or ErrQueryFailed.
+func Ping(ctx context.Context, dbURL string, timeout time.Duration) error {
+	return PingWithOptions(ctx, dbURL, timeout, PingOptions{})
+}
+
+// PingOptions controls how PingWithOptions connects. The zero value matches
+// Ping.
+type PingOptions struct {
+	// TLS overrides the URL's TLS settings, e.g. to verify a managed
+	// provider's certificate.
+	TLS TLSOptions
+}
+
+// PingWithOptions is like Ping but connects with the settings in opts.
+func PingWithOptions(ctx context.Context, dbURL string, timeout time.Duration, opts PingOptions) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return ping(ctx, dbURL, opts.TLS, pgxConnect)
+}
+
+// PingConn is like Ping but checks an existing connection, such as one
+// acquired from a pool, by running `SELECT 1` on it. The caller keeps
+// ownership of conn and bounds the check through ctx. Failures wrap
+// ErrQueryFailed.
+func PingConn(ctx context.Context, conn Querier) error {
+	return pingConn(ctx, conn)
+}
+
+// ping implements Ping with an injectable connector.
+func ping(ctx context.Context, dbURL string, tlsOpts TLSOptions, connect connector) error {
+	return withTLSConn(ctx, dbURL, tlsOpts, 0, connect, func(ctx context.Context, conn closableConn) error {
+		return pingConn(ctx, conn)
+	})
+}
+
+func pingConn(ctx context.Context, conn dbConn) error {
+	if _, err := scalar[int64](ctx, conn, "SELECT 1"); err != nil {
+		return fmt.Errorf("%w: %w", ErrQueryFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestPing_InvalidURL(t *testing.T) {
+	err := Ping(context.Background(), "postgres://u:p@h:notaport/db", time.Second)
+	if !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL, got %v", err)
+	}
+}
+
+func TestPing_Connector(t *testing.T) {
+	const dbURL = "postgres://u:p@h:1234/db"
+	conn := &fakeConn{rows: map[string][][]any{"SELECT 1": {{int64(1)}}}}
+	ok := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+
+	if err := ping(context.Background(), dbURL, TLSOptions{}, ok); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !conn.closed {
+		t.Fatalf("expected connection to be closed")
+	}
+
+	refused := func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+		return nil, errors.New("connection refused")
+	}
+	if err := ping(context.Background(), dbURL, TLSOptions{}, refused); !errors.Is(err, ErrConnectFailed) {
+		t.Fatalf("expected ErrConnectFailed, got %v", err)
+	}
+
+	noRows := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return &fakeConn{}, nil }
+	if err := ping(context.Background(), dbURL, TLSOptions{}, noRows); !errors.Is(err, ErrQueryFailed) {
+		t.Fatalf("expected ErrQueryFailed, got %v", err)
+	}
+}
+
+func TestPingConn(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{"SELECT 1": {{int64(1)}}}}
+	if err := pingConn(context.Background(), conn); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if conn.closed {
+		t.Fatalf("expected caller's connection to be left open")
+	}
+
+	if err := pingConn(context.Background(), &fakeConn{}); !errors.Is(err, ErrQueryFailed) {
+		t.Fatalf("expected ErrQueryFailed, got %v", err)
+	}
+}
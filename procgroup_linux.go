@@ -0,0 +1,40 @@
+//go:build linux
+
+package psqltoolbox
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// groupRunning reports whether any process in process group pgid is still
+// running. Members that have exited but not been reaped yet do not count:
+// orphans are left to init, which may take a while to reap them.
+func groupRunning(pgid int) bool {
+	stats, err := filepath.Glob("/proc/[0-9]*/stat")
+	if err != nil {
+		return groupExists(pgid)
+	}
+	for _, path := range stats {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		// the fields after the command name, which may itself contain
+		// spaces and parentheses, are: state ppid pgrp ...
+		i := bytes.LastIndexByte(b, ')')
+		if i < 0 {
+			continue
+		}
+		fields := bytes.Fields(b[i+1:])
+		if len(fields) < 3 || string(fields[0]) == "Z" {
+			continue
+		}
+		if pgrp, err := strconv.Atoi(string(fields[2])); err == nil && pgrp == pgid {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package psqltoolbox
+
+import (
+	"os/exec"
+	"time"
+)
+
+// setProcessGroup leaves cmd as is: without process groups, cancelling its
+// context kills only cmd itself, and killRest has nothing to do.
+func setProcessGroup(cmd *exec.Cmd) (killRest func(grace time.Duration)) {
+	return func(time.Duration) {}
+}
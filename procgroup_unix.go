@@ -0,0 +1,77 @@
+//go:build unix
+
+package psqltoolbox
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// groupPollInterval is how often killRest checks whether the rest of a
+// process group has exited.
+const groupPollInterval = 50 * time.Millisecond
+
+// setProcessGroup starts cmd in a new process group and makes cancelling its
+// context send SIGTERM to the whole group instead of killing only cmd. The
+// returned killRest, called once cmd has exited, gives the rest of the group
+// until grace after that SIGTERM to exit and then sends SIGKILL to whatever is
+// left. If cmd exited before its context was cancelled, killRest sends the
+// SIGTERM itself; if cmd never started, there is nothing to do.
+func setProcessGroup(cmd *exec.Cmd) (killRest func(grace time.Duration)) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var (
+		mu     sync.Mutex
+		termAt time.Time
+	)
+	terminate := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if termAt.IsZero() {
+			termAt = time.Now()
+		}
+		return signalGroup(cmd, syscall.SIGTERM)
+	}
+	cmd.Cancel = terminate
+	return func(grace time.Duration) {
+		if cmd.Process == nil {
+			return
+		}
+		mu.Lock()
+		sent := !termAt.IsZero()
+		mu.Unlock()
+		if !sent && errors.Is(terminate(), os.ErrProcessDone) {
+			return
+		}
+		mu.Lock()
+		deadline := termAt.Add(grace)
+		mu.Unlock()
+		for time.Now().Before(deadline) {
+			if !groupRunning(cmd.Process.Pid) {
+				return
+			}
+			time.Sleep(groupPollInterval)
+		}
+		signalGroup(cmd, syscall.SIGKILL)
+	}
+}
+
+// groupExists reports whether process group pgid has any members, including
+// ones that have exited but not been reaped.
+func groupExists(pgid int) bool {
+	return !errors.Is(syscall.Kill(-pgid, 0), syscall.ESRCH)
+}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := syscall.Kill(-cmd.Process.Pid, sig)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
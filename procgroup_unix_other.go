@@ -0,0 +1,8 @@
+//go:build unix && !linux
+
+package psqltoolbox
+
+// groupRunning reports whether process group pgid has any members left.
+func groupRunning(pgid int) bool {
+	return groupExists(pgid)
+}
@@ -0,0 +1,55 @@
+//go:build unix
+
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Test that a child of a cancelled tool gets time to exit on SIGTERM after
+// the tool itself has gone, rather than being killed straight away.
+func TestExecRunner_ChildGrace(t *testing.T) {
+	dir := t.TempDir()
+	ready, done := filepath.Join(dir, "ready"), filepath.Join(dir, "done")
+	script := filepath.Join(dir, "tool")
+	body := `#!/bin/sh
+(trap 'sleep 0.3; echo ok > "$2"; exit 0' TERM; touch "$1"; while :; do sleep 0.05; done) &
+trap 'exit 0' TERM
+wait
+`
+	if err := os.WriteFile(script, []byte(body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		for {
+			if _, err := os.Stat(ready); err == nil {
+				cancel()
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	_ = ExecRunner{}.Run(ctx, script, []string{ready, done}, nil, nil, nil)
+
+	if _, err := os.Stat(done); err != nil {
+		t.Fatalf("expected the child to finish its SIGTERM handler before Run returned: %v", err)
+	}
+}
+
+// Test that a run whose context is already done never starts the tool and
+// returns the context's error rather than crashing.
+func TestExecRunner_CancelledBeforeStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ExecRunner{}.Run(ctx, "/bin/true", nil, nil, nil, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
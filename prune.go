@@ -0,0 +1,117 @@
+package psqltoolbox
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// PruneOptions controls PruneDumpsWithOptions. The zero value matches
+// PruneDumps.
+type PruneOptions struct {
+	// DryRun reports the dumps that would be deleted without deleting
+	// anything.
+	DryRun bool
+}
+
+// PruneDumps deletes old dumps from dir, such as those written nightly by
+// PgDumpToFile. Of the regular files matching the glob pattern, it keeps the
+// keep most recently modified and deletes the rest, as well as any older than
+// maxAge. A keep or maxAge of zero or less disables that limit. The most
+// recent dump is never deleted. A deleted dump's checksum and metadata
+// sidecars are deleted with it. The deleted dumps are returned, oldest
+// first, even if deleting a later one fails.
+func PruneDumps(dir, pattern string, keep int, maxAge time.Duration) ([]string, error) {
+	return PruneDumpsWithOptions(dir, pattern, keep, maxAge, PruneOptions{})
+}
+
+// PruneDumpsWithOptions is like PruneDumps but can do a dry run through opts.
+func PruneDumpsWithOptions(dir, pattern string, keep int, maxAge time.Duration, opts PruneOptions) ([]string, error) {
+	dumps, err := listDumps(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	stale := staleDumps(dumps, keep, maxAge, time.Now())
+
+	var deleted []string
+	for _, d := range stale {
+		if !opts.DryRun {
+			if err := removeDump(d.path); err != nil {
+				return deleted, err
+			}
+		}
+		deleted = append(deleted, d.path)
+	}
+	return deleted, nil
+}
+
+// dumpFile is a dump found by listDumps.
+type dumpFile struct {
+	path    string
+	modTime time.Time
+}
+
+// listDumps returns the regular files in dir matching pattern, newest first,
+// leaving out checksum and metadata sidecars.
+func listDumps(dir, pattern string) ([]dumpFile, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("prune dumps: %w", err)
+	}
+	var dumps []dumpFile
+	for _, path := range matches {
+		if isDumpSidecar(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("prune dumps: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		dumps = append(dumps, dumpFile{path: path, modTime: info.ModTime()})
+	}
+	slices.SortStableFunc(dumps, func(a, b dumpFile) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	return dumps, nil
+}
+
+// staleDumps picks the dumps to delete from dumps, sorted newest first, and
+// returns them oldest first. The first dump is always kept.
+func staleDumps(dumps []dumpFile, keep int, maxAge time.Duration, now time.Time) []dumpFile {
+	var stale []dumpFile
+	for i, d := range dumps {
+		if i == 0 {
+			continue
+		}
+		if (keep > 0 && i >= keep) || (maxAge > 0 && now.Sub(d.modTime) > maxAge) {
+			stale = append(stale, d)
+		}
+	}
+	slices.Reverse(stale)
+	return stale
+}
+
+func isDumpSidecar(path string) bool {
+	return strings.HasSuffix(path, ChecksumPath("")) || strings.HasSuffix(path, MetadataPath(""))
+}
+
+// removeDump deletes path and any sidecars written next to it.
+func removeDump(path string) error {
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("prune dumps: %w", err)
+	}
+	for _, sidecar := range []string{ChecksumPath(path), MetadataPath(path)} {
+		if err := os.Remove(sidecar); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("prune dumps: %w", err)
+		}
+	}
+	return nil
+}
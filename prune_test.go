@@ -0,0 +1,140 @@
+package psqltoolbox
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeDumps creates one file per age in a temp dir, named by its index, with
+// its modification time that far in the past.
+func writeDumps(t *testing.T, ages ...time.Duration) (string, []string) {
+	t.Helper()
+	dir := t.TempDir()
+	now := time.Now()
+	var paths []string
+	for i, age := range ages {
+		path := filepath.Join(dir, "app-"+string(rune('a'+i))+".dump")
+		if err := os.WriteFile(path, []byte("dump"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := now.Add(-age)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return dir, paths
+}
+
+func remaining(t *testing.T, paths []string) []string {
+	t.Helper()
+	var left []string
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			left = append(left, p)
+		}
+	}
+	return left
+}
+
+func TestPruneDumps_Keep(t *testing.T) {
+	day := 24 * time.Hour
+	dir, paths := writeDumps(t, 3*day, 1*day, 4*day, 2*day)
+	// a stale dump's checksum goes with it; files outside the pattern stay
+	if err := os.WriteFile(ChecksumPath(paths[2]), []byte("sum"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := PruneDumps(dir, "app-*.dump", 2, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// oldest first: c is 4 days old, a is 3
+	if want := []string{paths[2], paths[0]}; !slices.Equal(deleted, want) {
+		t.Fatalf("expected %v deleted, got %v", want, deleted)
+	}
+	if left := remaining(t, paths); !slices.Equal(left, []string{paths[1], paths[3]}) {
+		t.Fatalf("expected the two newest dumps kept, got %v", left)
+	}
+	if _, err := os.Stat(ChecksumPath(paths[2])); !os.IsNotExist(err) {
+		t.Fatalf("expected the deleted dump's checksum to be removed, got %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("expected files outside the pattern to be kept: %v", err)
+	}
+}
+
+func TestPruneDumps_MaxAge(t *testing.T) {
+	day := 24 * time.Hour
+	dir, paths := writeDumps(t, 1*day, 10*day, 5*day)
+
+	deleted, err := PruneDumps(dir, "*.dump", 0, 7*day)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{paths[1]}) {
+		t.Fatalf("expected only the 10-day-old dump deleted, got %v", deleted)
+	}
+
+	// keep and maxAge combine: either one marks a dump for deletion
+	dir, paths = writeDumps(t, 1*day, 10*day, 5*day, 2*day)
+	deleted, err = PruneDumps(dir, "*.dump", 3, 7*day)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{paths[1]}) {
+		t.Fatalf("expected only the 10-day-old dump deleted, got %v", deleted)
+	}
+	deleted, err = PruneDumps(dir, "*.dump", 2, 7*day)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{paths[2]}) {
+		t.Fatalf("expected the 5-day-old dump deleted, got %v", deleted)
+	}
+}
+
+// Test that the most recent dump survives even when it is too old or keep
+// asks for none.
+func TestPruneDumps_KeepsNewest(t *testing.T) {
+	day := 24 * time.Hour
+	dir, paths := writeDumps(t, 30*day, 40*day)
+
+	deleted, err := PruneDumps(dir, "*.dump", 0, day)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{paths[1]}) {
+		t.Fatalf("expected only the older dump deleted, got %v", deleted)
+	}
+	if left := remaining(t, paths); !slices.Equal(left, []string{paths[0]}) {
+		t.Fatalf("expected the newest dump kept, got %v", left)
+	}
+}
+
+func TestPruneDumps_DryRun(t *testing.T) {
+	day := 24 * time.Hour
+	dir, paths := writeDumps(t, 1*day, 2*day, 3*day)
+
+	deleted, err := PruneDumpsWithOptions(dir, "*.dump", 1, 0, PruneOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(deleted, []string{paths[2], paths[1]}) {
+		t.Fatalf("expected the two older dumps reported, got %v", deleted)
+	}
+	if left := remaining(t, paths); len(left) != 3 {
+		t.Fatalf("expected a dry run to delete nothing, got %v left", left)
+	}
+
+	if _, err := PruneDumps(dir, "[", 1, 0); err == nil {
+		t.Fatalf("expected an error for a malformed pattern")
+	}
+}
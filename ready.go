@@ -0,0 +1,124 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// errNotReady is the probe error recorded while a readiness check reports
+// false.
+var errNotReady = errors.New("readiness check not satisfied")
+
+// WaitOptions controls how WaitForDatabaseReadyWithOptions polls. The zero
+// value matches WaitForDatabaseReady.
+type WaitOptions struct {
+	// Ready, when set, is called on every connection that answers
+	// `SELECT 1`, and the wait only succeeds once it returns true. Use it to
+	// wait for a condition beyond connectivity, such as a migration version
+	// or a table existing. Errors from Ready are treated like connection
+	// errors: the wait keeps polling and reports the last one on timeout.
+	Ready func(ctx context.Context, conn *pgx.Conn) (bool, error)
+
+	// Jitter randomizes each wait between half and all of the interval, so
+	// that many clients started together do not poll in lockstep.
+	Jitter bool
+
+	// TLS overrides the URL's TLS settings for every probe connection.
+	TLS TLSOptions
+}
+
+// WaitForDatabaseReady polls the database described by dbURL until it accepts
+// a connection and answers `SELECT 1`, or until timeout elapses. Attempts are
+// made at most once per interval. On timeout the last connection error is
+// returned; cancelling ctx stops the wait immediately.
+func WaitForDatabaseReady(ctx context.Context, dbURL string, interval, timeout time.Duration) error {
+	return WaitForDatabaseReadyWithOptions(ctx, dbURL, interval, timeout, WaitOptions{})
+}
+
+// WaitForDatabaseReadyWithOptions is like WaitForDatabaseReady but can also
+// wait for a readiness predicate and jitter the polling interval through opts.
+func WaitForDatabaseReadyWithOptions(ctx context.Context, dbURL string, interval, timeout time.Duration, opts WaitOptions) error {
+	var check func(context.Context, closableConn) (bool, error)
+	if opts.Ready != nil {
+		check = func(ctx context.Context, conn closableConn) (bool, error) {
+			return opts.Ready(ctx, conn.(*pgx.Conn))
+		}
+	}
+	return waitForReady(ctx, interval, timeout, opts.Jitter, func(ctx context.Context) error {
+		return readyProbe(ctx, dbURL, opts.TLS, pgxConnect, check)
+	})
+}
+
+// readyProbe pings dbURL and, when check is set, requires it to report true
+// on the same connection.
+func readyProbe(ctx context.Context, dbURL string, tlsOpts TLSOptions, connect connector, check func(context.Context, closableConn) (bool, error)) error {
+	if check == nil {
+		return ping(ctx, dbURL, tlsOpts, connect)
+	}
+	return withTLSConn(ctx, dbURL, tlsOpts, 0, connect, func(ctx context.Context, conn closableConn) error {
+		if err := pingConn(ctx, conn); err != nil {
+			return err
+		}
+		ok, err := check(ctx, conn)
+		if err != nil {
+			return fmt.Errorf("readiness check: %w", err)
+		}
+		if !ok {
+			return errNotReady
+		}
+		return nil
+	})
+}
+
+// waitForReady calls probe until it returns nil, waiting interval between
+// attempts, for at most timeout. With jitter each wait is randomized between
+// half and all of interval.
+func waitForReady(parentCtx context.Context, interval, timeout time.Duration, jitter bool, probe func(context.Context) error) error {
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		if err := ctx.Err(); err != nil {
+			return readyErr(parentCtx, timeout, lastErr, err)
+		}
+		if lastErr = probe(ctx); lastErr == nil {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return readyErr(parentCtx, timeout, lastErr, ctx.Err())
+		case <-time.After(pollDelay(interval, jitter)):
+		}
+	}
+}
+
+// pollDelay returns interval, or with jitter a random delay in
+// [interval/2, interval].
+func pollDelay(interval time.Duration, jitter bool) time.Duration {
+	if !jitter || interval <= 0 {
+		return interval
+	}
+	half := interval / 2
+	return half + rand.N(interval-half+1)
+}
+
+// readyErr builds the error returned when waitForReady gives up.
+func readyErr(parentCtx context.Context, timeout time.Duration, lastErr, ctxErr error) error {
+	if parentErr := parentCtx.Err(); parentErr != nil {
+		ctxErr = parentErr
+	}
+	if lastErr == nil {
+		return fmt.Errorf("wait for database: %w", ctxErr)
+	}
+	if errors.Is(ctxErr, context.DeadlineExceeded) && parentCtx.Err() == nil {
+		return fmt.Errorf("database not ready after %s: %w", timeout, lastErr)
+	}
+	return fmt.Errorf("wait for database: %w (last error: %v)", ctxErr, lastErr)
+}
@@ -0,0 +1,113 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestWaitForDatabaseReady_CancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := WaitForDatabaseReady(ctx, "postgres://u:p@127.0.0.1:1/db", 10*time.Millisecond, 5*time.Second)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// Test that waitForReady retries a failing probe until it succeeds.
+func TestWaitForReady_EventuallySucceeds(t *testing.T) {
+	attempts := 0
+	probe := func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	if err := waitForReady(context.Background(), 10*time.Millisecond, 5*time.Second, false, probe); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+// Test that waitForReady returns the last probe error on timeout.
+func TestWaitForReady_Timeout(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	probe := func(context.Context) error { return errRefused }
+
+	err := waitForReady(context.Background(), 10*time.Millisecond, 100*time.Millisecond, false, probe)
+	if !errors.Is(err, errRefused) {
+		t.Fatalf("expected last probe error, got %v", err)
+	}
+}
+
+// Test that the readiness check is evaluated on every connection and the wait
+// only succeeds once it reports true.
+func TestWaitForReady_Predicate(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{"SELECT 1": {{int64(1)}}}}
+	connect := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+	checks := 0
+	check := func(_ context.Context, c closableConn) (bool, error) {
+		if c != conn {
+			t.Fatalf("check got a different connection")
+		}
+		checks++
+		return checks >= 3, nil
+	}
+
+	probe := func(ctx context.Context) error {
+		return readyProbe(ctx, "postgres://u:p@h:5432/db", TLSOptions{}, connect, check)
+	}
+	if err := waitForReady(context.Background(), 10*time.Millisecond, 5*time.Second, true, probe); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checks != 3 {
+		t.Fatalf("expected 3 checks, got %d", checks)
+	}
+	if !conn.closed {
+		t.Fatalf("expected the connection to be closed")
+	}
+}
+
+// Test that a check that never passes times out with errNotReady, and that a
+// failing check's error is reported.
+func TestWaitForReady_PredicateTimeout(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{"SELECT 1": {{int64(1)}}}}
+	connect := func(context.Context, *pgx.ConnConfig) (closableConn, error) { return conn, nil }
+	errMissing := errors.New(`relation "widgets" does not exist`)
+
+	for _, c := range []struct {
+		check   func(context.Context, closableConn) (bool, error)
+		wantErr error
+	}{
+		{func(context.Context, closableConn) (bool, error) { return false, nil }, errNotReady},
+		{func(context.Context, closableConn) (bool, error) { return false, errMissing }, errMissing},
+	} {
+		probe := func(ctx context.Context) error {
+			return readyProbe(ctx, "postgres://u:p@h:5432/db", TLSOptions{}, connect, c.check)
+		}
+		err := waitForReady(context.Background(), 10*time.Millisecond, 50*time.Millisecond, false, probe)
+		if !errors.Is(err, c.wantErr) {
+			t.Fatalf("expected %v, got %v", c.wantErr, err)
+		}
+	}
+}
+
+func TestPollDelay(t *testing.T) {
+	if d := pollDelay(100*time.Millisecond, false); d != 100*time.Millisecond {
+		t.Fatalf("expected the plain interval without jitter, got %s", d)
+	}
+	for range 100 {
+		if d := pollDelay(100*time.Millisecond, true); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jittered delay %s outside [50ms, 100ms]", d)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package psqltoolbox
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redactedPassword replaces passwords in redacted URLs.
+const redactedPassword = "****"
+
+// RedactURL returns raw with any password replaced by ****, for use in logs
+// and error messages. Both the password in the user info and a password query
+// parameter, which libpq also accepts, are masked. URLs that cannot be parsed
+// are redacted on a best-effort basis by masking everything between the user
+// name and the last '@'.
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err == nil {
+		if _, ok := u.User.Password(); ok {
+			// url.URL.Redacted masks with "xxxxx"; the user name is escaped,
+			// so the first ":xxxxx@" is always the password.
+			raw = strings.Replace(u.Redacted(), ":xxxxx@", ":"+redactedPassword+"@", 1)
+		}
+		return redactQueryPassword(raw)
+	}
+
+	scheme := strings.Index(raw, "://")
+	if scheme < 0 {
+		return redactQueryPassword(raw)
+	}
+	rest := raw[scheme+3:]
+	at := strings.LastIndex(rest, "@")
+	if at < 0 {
+		return redactQueryPassword(raw)
+	}
+	colon := strings.Index(rest[:at], ":")
+	if colon < 0 {
+		return redactQueryPassword(raw)
+	}
+	return redactQueryPassword(raw[:scheme+3] + rest[:colon+1] + redactedPassword + rest[at:])
+}
+
+// redactQueryPassword masks the value of any password parameter in the query
+// of raw, leaving the other parameters and their order as they were.
+func redactQueryPassword(raw string) string {
+	q := strings.IndexByte(raw, '?')
+	if q < 0 {
+		return raw
+	}
+	params := strings.Split(raw[q+1:], "&")
+	for i, p := range params {
+		key, _, _ := strings.Cut(p, "=")
+		if k, err := url.QueryUnescape(key); err == nil && k == "password" {
+			params[i] = key + "=" + redactedPassword
+		}
+	}
+	return raw[:q+1] + strings.Join(params, "&")
+}
+
+// Redacted is like String but with the password replaced by ****.
+func (c *ConnConfig) Redacted() string {
+	return RedactURL(c.String())
+}
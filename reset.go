@@ -0,0 +1,397 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ResetOptions controls how DropTablesAndMigrateWithOptions resets a database.
+// The zero value matches DropTablesAndMigrate.
+type ResetOptions struct {
+	// MigrateBinary is the path to the migrate executable. When empty,
+	// "migrate" is resolved from PATH.
+	MigrateBinary string
+	// MigrateRunner runs migrate, as MigrateOptions.Runner does.
+	MigrateRunner CommandRunner
+
+	// Logger receives progress messages. When nil, messages are printed to
+	// stdout prefixed with an RFC 3339 timestamp.
+	Logger *slog.Logger
+
+	// MigrateTimeout bounds the migrate step. Defaults to
+	// DefaultMigrateTimeout when zero.
+	MigrateTimeout time.Duration
+
+	// MigrateLockRetries and MigrateLockRetryDelay retry the migrate step
+	// when it fails with ErrMigrationLocked, as MigrateOptions.LockRetries
+	// and MigrateOptions.LockRetryDelay do. Each retry gets a fresh
+	// MigrateTimeout.
+	MigrateLockRetries    int
+	MigrateLockRetryDelay time.Duration
+
+	// MigrationsSource is a golang-migrate source URL, such as
+	// s3://bucket/migrations, to run the migrations from instead of a local
+	// directory, as MigrateOptions.Source does. The migrations path must
+	// then be empty.
+	MigrationsSource string
+
+	// SkipDrop leaves every object in place and only runs the migrations,
+	// applying pending schema changes to a populated database.
+	SkipDrop bool
+
+	// DryRun lists the tables that would be dropped and the migrate command
+	// that would run, logging each, without changing the database.
+	DryRun bool
+
+	// DropViews, DropMaterializedViews, DropSequences, DropFunctions and
+	// DropTypes additionally clear those kinds of objects. Tables are always
+	// dropped. Functions covers procedures and aggregates; Types covers
+	// enum, composite, range and domain types. Objects owned by extensions
+	// are left alone.
+	DropViews             bool
+	DropMaterializedViews bool
+	DropSequences         bool
+	DropFunctions         bool
+	DropTypes             bool
+
+	// Transactional runs the whole drop phase in a single transaction, so a
+	// failing DROP rolls back every other drop. Migrations run afterwards in
+	// a separate process and are not covered.
+	Transactional bool
+
+	// Schemas lists the schemas to clear, each in turn. Defaults to public.
+	Schemas []string
+
+	// ExcludeTables lists tables to keep, such as reference data loaded by
+	// another process. Names match exactly in every schema being cleared;
+	// qualify one as schema.table to keep it in that schema only. CASCADE
+	// still drops foreign keys on a kept table that point at dropped ones.
+	ExcludeTables []string
+
+	// StatementTimeout and LockTimeout bound each DROP through the session's
+	// statement_timeout and lock_timeout, so a DROP blocked by another
+	// session's lock fails instead of hanging. They default to
+	// DefaultDropStatementTimeout and DefaultDropLockTimeout when zero; a
+	// negative value leaves the setting alone. Both are reset to the session
+	// default once the drop phase ends.
+	StatementTimeout time.Duration
+	LockTimeout      time.Duration
+
+	// Analyze runs ANALYZE once the migrations have been applied, so the
+	// recreated tables have planner statistics before the first query.
+	Analyze bool
+
+	// Verify, when set, is called with conn once the reset has succeeded,
+	// to check that the migrations produced the expected schema, e.g. that
+	// a table or column exists. An error it returns fails the reset, though
+	// the reset itself has already happened. Dry runs skip it.
+	Verify func(ctx context.Context, conn Querier) error
+
+	// AuditWriter, when set, receives an AuditEvent as a JSON line once the
+	// reset has finished or failed, naming dbURL and the objects dropped. A
+	// failed Verify is recorded as a failure. Dry runs and resets that fail
+	// their checks before dropping anything are not recorded.
+	AuditWriter io.Writer
+
+	// verify is Verify bound to the caller's connection, run by
+	// resetDatabase before the reset is audited.
+	verify func(ctx context.Context) error
+}
+
+// Defaults for ResetOptions.StatementTimeout and ResetOptions.LockTimeout.
+const (
+	DefaultDropStatementTimeout = 5 * time.Minute
+	DefaultDropLockTimeout      = time.Minute
+)
+
+// dropTimeouts returns the session settings to apply during the drop phase,
+// as setting name and value pairs.
+func (o ResetOptions) dropTimeouts() [][2]string {
+	var settings [][2]string
+	add := func(name string, d, def time.Duration) {
+		if d == 0 {
+			d = def
+		}
+		if d > 0 {
+			settings = append(settings, [2]string{name, fmt.Sprintf("%dms", d.Milliseconds())})
+		}
+	}
+	add("statement_timeout", o.StatementTimeout, DefaultDropStatementTimeout)
+	add("lock_timeout", o.LockTimeout, DefaultDropLockTimeout)
+	return settings
+}
+
+// excludes reports whether ExcludeTables keeps table in schema.
+func (o ResetOptions) excludes(schema, table string) bool {
+	for _, t := range o.ExcludeTables {
+		if t == table || t == schema+"."+table {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateOptions returns the options for the migrate step.
+func (o ResetOptions) migrateOptions() MigrateOptions {
+	return MigrateOptions{
+		Binary:         o.MigrateBinary,
+		Runner:         o.MigrateRunner,
+		Timeout:        o.MigrateTimeout,
+		LockRetries:    o.MigrateLockRetries,
+		LockRetryDelay: o.MigrateLockRetryDelay,
+		Source:         o.MigrationsSource,
+	}
+}
+
+// migrations describes where the reset reads its migrations from, for
+// progress messages, along with the matching slog attribute. It is empty when
+// there are no migrations to run.
+func (o ResetOptions) migrations(migrationsPath string) (string, []any) {
+	if o.MigrationsSource != "" {
+		source := RedactURL(o.MigrationsSource)
+		return source, []any{"migrationsSource", source}
+	}
+	return migrationsPath, []any{"migrationsPath", migrationsPath}
+}
+
+// schemas returns the schemas a reset should clear.
+func (o ResetOptions) schemas() []string {
+	if len(o.Schemas) == 0 {
+		return []string{"public"}
+	}
+	return o.Schemas
+}
+
+// log reports a progress message through opts.Logger, or to stdout when no
+// logger is configured. args are slog key/value pairs.
+func (o ResetOptions) log(ctx context.Context, msg string, args ...any) {
+	if o.Logger == nil {
+		fmt.Printf("[%s] %s\n", time.Now().Format(time.RFC3339), msg)
+		return
+	}
+	o.Logger.InfoContext(ctx, msg, args...)
+}
+
+// DropTablesAndMigrate drops every table in the public schema and then, if
+// migrationsPath is non-empty, runs `migrate up` against dbURL. To run
+// migrations from a source URL instead, leave migrationsPath empty and set
+// ResetOptions.MigrationsSource.
+func DropTablesAndMigrate(ctx context.Context, conn Querier, dbURL, migrationsPath string) error {
+	_, err := DropTablesAndMigrateWithOptions(ctx, conn, dbURL, migrationsPath, ResetOptions{})
+	return err
+}
+
+// DropTablesAndMigrateWithOptions is like DropTablesAndMigrate but lets the
+// caller control the reset through opts. It returns the tables it dropped, or
+// in DryRun mode the tables that would have been dropped; tables outside the
+// public schema are schema-qualified. When opts.Verify fails, the dropped
+// tables are returned along with its error.
+func DropTablesAndMigrateWithOptions(ctx context.Context, conn Querier, dbURL, migrationsPath string, opts ResetOptions) ([]string, error) {
+	if opts.Verify != nil {
+		opts.verify = func(ctx context.Context) error { return opts.Verify(ctx, conn) }
+	}
+	var tables []string
+	err := withSessionConn(ctx, conn, func(conn dbConn) error {
+		var err error
+		tables, err = resetDatabase(ctx, conn, dbURL, migrationsPath, opts)
+		return err
+	})
+	return tables, err
+}
+
+// resetDatabase implements DropTablesAndMigrateWithOptions against any dbConn.
+func resetDatabase(ctx context.Context, conn dbConn, dbURL, migrationsPath string, opts ResetOptions) (tables []string, err error) {
+	// fail before dropping anything if the migrations can't be run afterwards
+	migrations, migrationsAttr := opts.migrations(migrationsPath)
+	switch {
+	case opts.MigrationsSource != "":
+		if _, err := migrateSourceArgs(migrationsPath, opts.MigrationsSource); err != nil {
+			return nil, err
+		}
+	case migrationsPath != "":
+		if err := checkMigrationsDir(migrationsPath); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun {
+		return dryRunReset(ctx, conn, dbURL, migrationsPath, opts)
+	}
+	if migrations != "" {
+		if _, err := toolBinary(opts.MigrateRunner, opts.MigrateBinary, "migrate", ErrMigrateFailed); err != nil {
+			return nil, err
+		}
+	}
+
+	var dropped []dbObject
+	defer func() {
+		err = audit(opts.AuditWriter, "drop tables and migrate", dbURL, auditNames(dropped), err)
+	}()
+
+	if opts.SkipDrop {
+		opts.log(ctx, "SkipDrop set; leaving existing tables in place.", "phase", "drop")
+	} else {
+		opts.log(ctx, "Clearing all tables in the database...", "phase", "drop", "schemas", opts.schemas())
+		var err error
+		// keep what a failed drop removed for the audit
+		if dropped, err = dropPhase(ctx, conn, opts); err != nil {
+			return nil, err
+		}
+		opts.log(ctx, "All tables cleared in the database.", "phase", "drop")
+	}
+
+	if migrations != "" {
+		opts.log(ctx, fmt.Sprintf("Running DB migrations from %s...", migrations), append([]any{"phase", "migrate"}, migrationsAttr...)...)
+		if err := runMigrate(ctx, opts.migrateOptions(), dbURL, migrationsPath, "up"); err != nil {
+			return nil, err
+		}
+		opts.log(ctx, "Migrations applied.", append([]any{"phase", "migrate"}, migrationsAttr...)...)
+	} else {
+		opts.log(ctx, "No migrations path provided; skipping migrate.", "phase", "migrate")
+	}
+
+	if opts.Analyze {
+		opts.log(ctx, "Analyzing the database...", "phase", "analyze")
+		if _, err := conn.Exec(ctx, "ANALYZE"); err != nil {
+			return nil, fmt.Errorf("analyze: %w", err)
+		}
+		opts.log(ctx, "Planner statistics refreshed.", "phase", "analyze")
+	}
+
+	if opts.verify != nil {
+		opts.log(ctx, "Verifying the migrated schema...", "phase", "verify")
+		if err := opts.verify(ctx); err != nil {
+			return tableNames(dropped), fmt.Errorf("verify migrated schema: %w", err)
+		}
+		opts.log(ctx, "Migrated schema verified.", "phase", "verify")
+	}
+	return tableNames(dropped), nil
+}
+
+// dropPhase lists and drops the objects opts selects, inside a transaction
+// when opts.Transactional is set. It returns the dropped objects, including
+// those dropped before a failure outside a transaction, which stay dropped.
+func dropPhase(ctx context.Context, conn dbConn, opts ResetOptions) ([]dbObject, error) {
+	if !opts.Transactional {
+		if err := setDropTimeouts(ctx, conn, opts, false); err != nil {
+			return nil, err
+		}
+		defer resetDropTimeouts(conn, opts)
+
+		objs, err := objectsToDrop(ctx, conn, opts)
+		if err != nil {
+			return nil, err
+		}
+		dropped, err := dropObjects(ctx, conn, objs, true)
+		if err != nil {
+			return dropped, explainDropTimeout(err)
+		}
+		return dropped, nil
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin drop transaction: %w", err)
+	}
+	// Rollback after a successful Commit is a no-op.
+	defer tx.Rollback(context.Background())
+
+	// local settings end with the transaction
+	if err := setDropTimeouts(ctx, tx, opts, true); err != nil {
+		return nil, err
+	}
+	objs, err := objectsToDrop(ctx, tx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dropObjects(ctx, tx, objs, false); err != nil {
+		return nil, fmt.Errorf("%w (drop transaction rolled back)", explainDropTimeout(err))
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("commit drop transaction: %w", err)
+	}
+	return objs, nil
+}
+
+// setConfigSQL changes a setting for the session, or with is_local only for
+// the current transaction.
+const setConfigSQL = `SELECT set_config($1, $2, $3)`
+
+// setDropTimeouts applies opts' statement and lock timeouts to conn.
+func setDropTimeouts(ctx context.Context, conn dbConn, opts ResetOptions, local bool) error {
+	for _, s := range opts.dropTimeouts() {
+		rows, err := conn.Query(ctx, setConfigSQL, s[0], s[1], local)
+		if err == nil {
+			rows.Close()
+			err = rows.Err()
+		}
+		if err != nil {
+			return fmt.Errorf("set %s: %w", s[0], err)
+		}
+	}
+	return nil
+}
+
+// resetDropTimeouts restores the session defaults changed by setDropTimeouts.
+// It runs even when the reset's context is done, and failures are ignored as
+// the drops themselves have already finished.
+func resetDropTimeouts(conn dbConn, opts ResetOptions) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, s := range opts.dropTimeouts() {
+		if rows, err := conn.Query(ctx, "RESET "+s[0]); err == nil {
+			rows.Close()
+		}
+	}
+}
+
+// explainDropTimeout annotates a DROP that failed because of the drop phase's
+// lock_timeout or statement_timeout.
+func explainDropTimeout(err error) error {
+	switch pgErrCode(err) {
+	case pgLockNotAvailable:
+		return fmt.Errorf("%w (lock_timeout exceeded: another session holds a conflicting lock)", err)
+	case pgQueryCanceled:
+		return fmt.Errorf("%w (canceled, possibly by statement_timeout)", err)
+	}
+	return err
+}
+
+// dryRunReset logs what resetDatabase would do and returns the tables it
+// would drop, without executing any DROP or running migrate.
+func dryRunReset(ctx context.Context, conn dbConn, dbURL, migrationsPath string, opts ResetOptions) ([]string, error) {
+	var objs []dbObject
+	if opts.SkipDrop {
+		opts.log(ctx, "Dry run: SkipDrop set; would leave existing tables in place.", "phase", "drop", "dryRun", true)
+	} else {
+		var err error
+		if objs, err = objectsToDrop(ctx, conn, opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range objs {
+		name := pgx.Identifier{o.Schema, o.Name}.Sanitize() + o.Args
+		opts.log(ctx, fmt.Sprintf("Dry run: would drop %s %s", strings.ToLower(o.Kind), name), "phase", "drop", "kind", o.Kind, "object", name, "dryRun", true)
+	}
+
+	if migrations, migrationsAttr := opts.migrations(migrationsPath); migrations != "" {
+		databaseArg, _ := migrateDatabaseArg(dbURL)
+		flag := "-path"
+		if opts.MigrationsSource != "" {
+			flag = "-source"
+		}
+		command := fmt.Sprintf("%s -database %s %s %s up", binaryOrDefault(opts.MigrateBinary, "migrate"), RedactURL(databaseArg), flag, migrations)
+		opts.log(ctx, fmt.Sprintf("Dry run: would run %s", command), append(append([]any{"phase", "migrate"}, migrationsAttr...), "command", command, "dryRun", true)...)
+	} else {
+		opts.log(ctx, "Dry run: no migrations path provided; would skip migrate.", "phase", "migrate", "dryRun", true)
+	}
+	if opts.Analyze {
+		opts.log(ctx, "Dry run: would run ANALYZE", "phase", "analyze", "dryRun", true)
+	}
+	return tableNames(objs), nil
+}
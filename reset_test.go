@@ -0,0 +1,568 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Test that progress messages go through the configured slog.Logger with fields.
+func TestResetOptions_LogUsesLogger(t *testing.T) {
+	var buf bytes.Buffer
+	opts := ResetOptions{Logger: slog.New(slog.NewJSONHandler(&buf, nil))}
+
+	opts.log(context.Background(), "Migrations applied.", "phase", "migrate", "migrationsPath", "/migrations")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("expected one JSON log record, got %q: %v", buf.String(), err)
+	}
+	if rec["msg"] != "Migrations applied." || rec["phase"] != "migrate" || rec["migrationsPath"] != "/migrations" {
+		t.Fatalf("unexpected log record: %v", rec)
+	}
+}
+
+// Test that a dry run lists tables and executes nothing.
+func TestResetDatabase_DryRun(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+	)}
+	var buf bytes.Buffer
+	opts := ResetOptions{DryRun: true, Logger: slog.New(slog.NewTextHandler(&buf, nil))}
+
+	dir := writeMigrations(t)
+	tables, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", dir, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(tables, []string{"orders", "users"}) {
+		t.Fatalf("unexpected tables: %v", tables)
+	}
+	if len(conn.execs) != 0 {
+		t.Fatalf("expected no statements executed, got %v", conn.execs)
+	}
+	out := buf.String()
+	for _, want := range []string{`would drop table \"public\".\"orders\"`, `would drop table \"public\".\"users\"`, "migrate -database postgres://u@h:1234/db -path " + dir + " up"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected log to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "u:p@") {
+		t.Fatalf("dry run log leaked credentials:\n%s", out)
+	}
+}
+
+// Test that optional object categories are dropped only when enabled.
+func TestResetDatabase_DropsOptionalObjects(t *testing.T) {
+	objs := []dbObject{
+		{Kind: "VIEW", Schema: "public", Name: "active_users"},
+		{Kind: "TABLE", Schema: "public", Name: "users"},
+		{Kind: "FUNCTION", Schema: "public", Name: "touch", Args: "(integer)"},
+		{Kind: "TYPE", Schema: "public", Name: "mood"},
+	}
+	discard := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	conn := &fakeConn{rowsFor: catalogRows(objs...)}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", ResetOptions{Logger: discard}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{`DROP TABLE IF EXISTS "public"."users" CASCADE`}; !slices.Equal(conn.execs, want) {
+		t.Fatalf("default reset executed %v, want %v", conn.execs, want)
+	}
+
+	conn = &fakeConn{rowsFor: catalogRows(objs...)}
+	opts := ResetOptions{Logger: discard, DropViews: true, DropFunctions: true, DropTypes: true}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		`DROP VIEW IF EXISTS "public"."active_users" CASCADE`,
+		`DROP TABLE IF EXISTS "public"."users" CASCADE`,
+		`DROP FUNCTION IF EXISTS "public"."touch"(integer) CASCADE`,
+		`DROP TYPE IF EXISTS "public"."mood" CASCADE`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed:\n%v\nwant:\n%v", conn.execs, want)
+	}
+}
+
+// Test that only the requested schemas are cleared.
+func TestResetDatabase_Schemas(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		dbObject{Kind: "TABLE", Schema: "tenant_a", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "tenant_b", Name: "orders"},
+	)}
+	opts := ResetOptions{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Schemas: []string{"tenant_a", `odd"name`},
+	}
+
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{`DROP TABLE IF EXISTS "tenant_a"."orders" CASCADE`}; !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+	// schema names are always passed as query parameters, never interpolated
+	for _, q := range conn.queries {
+		if strings.Contains(q.sql, "tenant_a") || strings.Contains(q.sql, "odd") {
+			t.Fatalf("schema name interpolated into SQL: %s", q.sql)
+		}
+	}
+
+	opts.DryRun = true
+	tables, err := resetDatabase(context.Background(), &fakeConn{rowsFor: conn.rowsFor}, "postgres://u:p@h:1234/db", "", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(tables, []string{"tenant_a.orders"}) {
+		t.Fatalf("unexpected dry run tables: %v", tables)
+	}
+}
+
+// Test that a failing DROP in transactional mode rolls back every drop.
+func TestResetDatabase_TransactionalRollback(t *testing.T) {
+	conn := &fakeConn{
+		rowsFor: catalogRows(
+			dbObject{Kind: "TABLE", Schema: "public", Name: "a"},
+			dbObject{Kind: "TABLE", Schema: "public", Name: "b"},
+			dbObject{Kind: "TABLE", Schema: "public", Name: "c"},
+		),
+		execErrOn: func(sql string) bool { return strings.Contains(sql, `"b"`) },
+	}
+	opts := ResetOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), Transactional: true}
+
+	_, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("expected rolled back error, got %v", err)
+	}
+	if len(conn.execs) != 0 {
+		t.Fatalf("expected no drops to be committed, got %v", conn.execs)
+	}
+	if conn.commits != 0 || conn.rollbacks != 1 {
+		t.Fatalf("expected 0 commits and 1 rollback, got %d and %d", conn.commits, conn.rollbacks)
+	}
+
+	conn.execErrOn = nil
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.execs) != 3 || conn.commits != 1 {
+		t.Fatalf("expected 3 committed drops, got %v (commits=%d)", conn.execs, conn.commits)
+	}
+}
+
+// Test that MigrateTimeout is honored and reported as context.DeadlineExceeded.
+func TestResetDatabase_MigrateTimeout(t *testing.T) {
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "migrate"), []byte("#!/usr/bin/env bash\nsleep 3\n"), 0o755); err != nil {
+		t.Fatalf("write fake migrate: %v", err)
+	}
+	opts := ResetOptions{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MigrateBinary:  filepath.Join(tmpdir, "migrate"),
+		MigrateTimeout: 200 * time.Millisecond,
+	}
+
+	start := time.Now()
+	_, err := resetDatabase(context.Background(), &fakeConn{}, "postgres://u:p@h:1234/db", writeMigrations(t), opts)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected migrate to be killed at the timeout; took %v", elapsed)
+	}
+}
+
+// Test that cancelling the caller's context kills migrate promptly and is
+// reported as context.Canceled rather than as the migrate timeout.
+func TestResetDatabase_MigrateCancelled(t *testing.T) {
+	tmpdir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(tmpdir, "migrate"), []byte("#!/usr/bin/env bash\nsleep 3\n"), 0o755); err != nil {
+		t.Fatalf("write fake migrate: %v", err)
+	}
+	opts := ResetOptions{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MigrateBinary: filepath.Join(tmpdir, "migrate"),
+		SkipDrop:      true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := resetDatabase(ctx, &fakeConn{}, "postgres://u:p@h:1234/db", writeMigrations(t), opts)
+	if !errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected only context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected migrate to be killed on cancellation; took %v", elapsed)
+	}
+
+	// an already cancelled context does not start migrate at all
+	err = runMigrate(ctx, MigrateOptions{Binary: filepath.Join(tmpdir, "missing")}, "postgres://u:p@h:1234/db", "/migrations", "up")
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrBinaryNotFound) {
+		t.Fatalf("expected context.Canceled before looking up migrate, got %v", err)
+	}
+}
+
+// Test that a missing migrate binary is reported before anything is dropped.
+func TestResetDatabase_MigrateNotFound(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	opts := ResetOptions{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MigrateBinary: filepath.Join(t.TempDir(), "migrate"),
+	}
+
+	_, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", writeMigrations(t), opts)
+	if !errors.Is(err, ErrBinaryNotFound) {
+		t.Fatalf("expected ErrBinaryNotFound, got %v", err)
+	}
+	if len(conn.execs) != 0 {
+		t.Fatalf("expected nothing dropped, got %v", conn.execs)
+	}
+}
+
+// Test that an unusable migrations path is reported before anything is dropped.
+func TestResetDatabase_MigrationsPathPreflight(t *testing.T) {
+	valid := writeMigrations(t)
+	file := filepath.Join(valid, "1_create_widgets.up.sql")
+	cases := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"nonexistent", filepath.Join(valid, "typo"), fs.ErrNotExist},
+		{"file", file, nil},
+		{"empty", t.TempDir(), ErrNoMigrationFiles},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+			opts := ResetOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			_, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", c.path, opts)
+			if err == nil || (c.wantErr != nil && !errors.Is(err, c.wantErr)) {
+				t.Fatalf("expected error wrapping %v, got %v", c.wantErr, err)
+			}
+			if len(conn.execs) != 0 || len(conn.queries) != 0 {
+				t.Fatalf("expected the database to be left alone, got execs %v", conn.execs)
+			}
+		})
+	}
+
+	if err := checkMigrationsDir(valid); err != nil {
+		t.Fatalf("expected valid migrations dir to pass, got %v", err)
+	}
+}
+
+// Test that the drop phase runs under statement_timeout and lock_timeout and
+// resets them afterwards.
+func TestResetDatabase_DropTimeouts(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	opts := ResetOptions{
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		StatementTimeout: 30 * time.Second,
+	}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var settings []string
+	for _, q := range conn.queries {
+		switch {
+		case q.sql == setConfigSQL:
+			settings = append(settings, fmt.Sprint(q.args))
+		case strings.HasPrefix(q.sql, "RESET "):
+			settings = append(settings, q.sql)
+		}
+	}
+	want := []string{
+		"[statement_timeout 30000ms false]",
+		"[lock_timeout 60000ms false]",
+		"RESET statement_timeout",
+		"RESET lock_timeout",
+	}
+	if !slices.Equal(settings, want) {
+		t.Fatalf("got settings %q, want %q", settings, want)
+	}
+
+	// transaction-local settings need no reset; negative disables a timeout
+	conn = &fakeConn{rowsFor: conn.rowsFor}
+	opts.Transactional = true
+	opts.LockTimeout = -1
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []string
+	for _, q := range conn.queries {
+		if q.sql == setConfigSQL || strings.HasPrefix(q.sql, "RESET ") {
+			got = append(got, fmt.Sprint(q.sql, q.args))
+		}
+	}
+	if want := []string{setConfigSQL + "[statement_timeout 30000ms true]"}; !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// Test that a DROP stopped by lock_timeout explains why.
+func TestExplainDropTimeout(t *testing.T) {
+	err := explainDropTimeout(fmt.Errorf("drop TABLE users: %w", &pgconn.PgError{Code: pgLockNotAvailable}))
+	if !strings.Contains(err.Error(), "lock_timeout exceeded") {
+		t.Fatalf("expected lock_timeout explanation, got %v", err)
+	}
+}
+
+// Test that SkipDrop leaves the database alone and still runs migrate.
+func TestResetDatabase_SkipDrop(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	opts := ResetOptions{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MigrateBinary: filepath.Join(dir, "migrate"),
+		SkipDrop:      true,
+	}
+	migrations := writeMigrations(t)
+
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", migrations, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.execs) != 0 || len(conn.queries) != 0 {
+		t.Fatalf("expected no statements, got execs %v and queries %v", conn.execs, conn.queries)
+	}
+	if args := readArgs(t, argsFile); args[len(args)-1] != "up" {
+		t.Fatalf("expected migrate up to run, got %v", args)
+	}
+}
+
+// Test that a real reset returns the tables it dropped.
+func TestResetDatabase_ReturnsDroppedTables(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		dbObject{Kind: "TABLE", Schema: "audit", Name: "events"},
+		dbObject{Kind: "VIEW", Schema: "public", Name: "active_users"},
+	)}
+	opts := ResetOptions{
+		Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Schemas:   []string{"public", "audit"},
+		DropViews: true,
+	}
+	tables, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"orders", "users", "audit.events"}; !slices.Equal(tables, want) {
+		t.Fatalf("got dropped tables %v, want %v", tables, want)
+	}
+	if len(conn.execs) != 4 {
+		t.Fatalf("expected 4 drops, got %v", conn.execs)
+	}
+}
+
+// Test that excluded tables survive the drop phase, by bare name in any
+// cleared schema or qualified in one schema only.
+func TestResetDatabase_ExcludeTables(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "public", Name: "countries"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "currencies"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		dbObject{Kind: "TABLE", Schema: "audit", Name: "countries"},
+		dbObject{Kind: "TABLE", Schema: "audit", Name: "currencies"},
+	)}
+	opts := ResetOptions{
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Schemas:       []string{"public", "audit"},
+		ExcludeTables: []string{"countries", "public.currencies"},
+	}
+	tables, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"orders", "users", "audit.currencies"}; !slices.Equal(tables, want) {
+		t.Fatalf("got dropped tables %v, want %v", tables, want)
+	}
+	want := []string{
+		`DROP TABLE IF EXISTS "public"."orders" CASCADE`,
+		`DROP TABLE IF EXISTS "public"."users" CASCADE`,
+		`DROP TABLE IF EXISTS "audit"."currencies" CASCADE`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+}
+
+// vanishingConn is a fakeConn on which tables named in gone were dropped by
+// someone else after being listed, and DROP fails with err.
+type vanishingConn struct {
+	*fakeConn
+	gone []string
+	err  error
+}
+
+func (c *vanishingConn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	for _, name := range c.gone {
+		if strings.Contains(sql, `"`+name+`"`) {
+			return pgconn.CommandTag{}, c.err
+		}
+	}
+	return c.fakeConn.Exec(ctx, sql, args...)
+}
+
+// Test that a table vanishing between listing and dropping does not fail the
+// reset, and is not reported as dropped.
+func TestResetDatabase_TableVanishes(t *testing.T) {
+	conn := &vanishingConn{
+		fakeConn: &fakeConn{rowsFor: catalogRows(
+			dbObject{Kind: "TABLE", Schema: "public", Name: "orders"},
+			dbObject{Kind: "TABLE", Schema: "public", Name: "sessions"},
+			dbObject{Kind: "TABLE", Schema: "public", Name: "users"},
+		)},
+		gone: []string{"sessions"},
+		err:  &pgconn.PgError{Code: pgUndefinedTable, Message: `table "sessions" does not exist`},
+	}
+	opts := ResetOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	tables, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"orders", "users"}; !slices.Equal(tables, want) {
+		t.Fatalf("got dropped tables %v, want %v", tables, want)
+	}
+	for _, sql := range conn.execs {
+		if !strings.HasPrefix(sql, "DROP TABLE IF EXISTS ") {
+			t.Fatalf("expected IF EXISTS drops, got %q", sql)
+		}
+	}
+
+	// other failures still stop the reset
+	conn.err = &pgconn.PgError{Code: "42501", Message: "must be owner of table sessions"}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err == nil {
+		t.Fatalf("expected a permission error to fail the reset")
+	}
+}
+
+// Test that Analyze runs ANALYZE once migrate has finished, and that nothing
+// is analyzed without it.
+func TestResetDatabase_Analyze(t *testing.T) {
+	dir, argsFile := writeArgsRecorder(t, "migrate")
+	migrations := writeMigrations(t)
+	var logs strings.Builder
+	opts := ResetOptions{
+		Logger:        slog.New(slog.NewTextHandler(&logs, nil)),
+		MigrateBinary: filepath.Join(dir, "migrate"),
+		SkipDrop:      true,
+		Analyze:       true,
+	}
+
+	conn := &fakeConn{}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", migrations, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(conn.execs, []string{"ANALYZE"}) {
+		t.Fatalf("expected ANALYZE, got %v", conn.execs)
+	}
+	readArgs(t, argsFile)
+	migrated, analyzed := strings.Index(logs.String(), "Migrations applied."), strings.Index(logs.String(), "phase=analyze")
+	if migrated < 0 || analyzed < migrated {
+		t.Fatalf("expected ANALYZE after migrate, got logs:\n%s", logs.String())
+	}
+
+	opts.Analyze = false
+	conn = &fakeConn{}
+	if _, err := resetDatabase(context.Background(), conn, "postgres://u:p@h:1234/db", migrations, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.execs) != 0 {
+		t.Fatalf("expected no ANALYZE by default, got %v", conn.execs)
+	}
+}
+
+// Test that a failing Verify fails the reset with its error, after the drop
+// has happened, and that dry runs do not call it.
+func TestDropTablesAndMigrate_Verify(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	errNoColumn := errors.New(`column "users.email" does not exist`)
+	var verified Querier
+	opts := ResetOptions{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Verify: func(_ context.Context, q Querier) error {
+			verified = q
+			return errNoColumn
+		},
+	}
+
+	var audited bytes.Buffer
+	opts.AuditWriter = &audited
+	tables, err := DropTablesAndMigrateWithOptions(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts)
+	if !errors.Is(err, errNoColumn) {
+		t.Fatalf("expected the verify error, got %v", err)
+	}
+	if ev := readAuditEvent(t, &audited); ev.Outcome != "failure" || ev.Error != err.Error() {
+		t.Fatalf("expected the failed verify to be audited, got %+v", ev)
+	}
+	opts.AuditWriter = nil
+	if verified != conn {
+		t.Fatalf("expected Verify to get the reset's connection")
+	}
+	if !slices.Equal(tables, []string{"users"}) || len(conn.execs) != 1 {
+		t.Fatalf("expected the drop to have run before verifying, got tables %v, execs %v", tables, conn.execs)
+	}
+
+	verified = nil
+	opts.DryRun = true
+	if _, err := DropTablesAndMigrateWithOptions(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if verified != nil {
+		t.Fatalf("expected a dry run to skip Verify")
+	}
+
+	opts.DryRun = false
+	opts.Verify = func(context.Context, Querier) error { return nil }
+	if _, err := DropTablesAndMigrateWithOptions(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// Test that a reset runs migrations from MigrationsSource with -source, and
+// refuses a migrations path alongside it before dropping anything.
+func TestDropTablesAndMigrate_MigrationsSource(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	runner := &fakeRunner{}
+	opts := ResetOptions{
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		MigrateRunner:    runner,
+		MigrationsSource: "github://acme/app/migrations",
+	}
+
+	if _, err := DropTablesAndMigrateWithOptions(context.Background(), conn, "postgres://u:p@h:1234/db", "", opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"-database", "postgres://u@h:1234/db", "-source", "github://acme/app/migrations", "up"}
+	if len(runner.calls) != 1 || !slices.Equal(runner.calls[0].args, want) {
+		t.Fatalf("got calls %v, want args %v", runner.calls, want)
+	}
+
+	conn.execs = nil
+	if _, err := DropTablesAndMigrateWithOptions(context.Background(), conn, "postgres://u:p@h:1234/db", "/migrations", opts); err == nil {
+		t.Fatalf("expected an error for both a path and a source URL")
+	}
+	if len(conn.execs) != 0 || len(runner.calls) != 1 {
+		t.Fatalf("expected nothing to run, got execs %v and %d migrate calls", conn.execs, len(runner.calls))
+	}
+}
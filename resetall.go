@@ -0,0 +1,78 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Result is the outcome of resetting one database with
+// DropTablesAndMigrateAll.
+type Result struct {
+	// URL is the database URL, with the password redacted.
+	URL string
+	// Tables lists the tables dropped, as returned by
+	// DropTablesAndMigrateWithOptions.
+	Tables []string
+	// Err is the reset's error, or nil when it succeeded. A database that
+	// was never reset because ctx was cancelled first holds ctx's error.
+	Err error
+}
+
+// DropTablesAndMigrateAll runs DropTablesAndMigrate against each of dbURLs,
+// e.g. one database per tenant, resetting at most concurrency of them at once
+// over a connection of its own. A failed reset does not stop the others. Once
+// ctx is cancelled no further resets are started. The results are in the
+// order of dbURLs; when any reset failed, the returned error joins their
+// errors, each prefixed with its redacted URL.
+func DropTablesAndMigrateAll(ctx context.Context, dbURLs []string, migrationsPath string, concurrency int) ([]Result, error) {
+	return dropTablesAndMigrateAll(ctx, dbURLs, migrationsPath, concurrency, ResetOptions{}, pgxConnect)
+}
+
+func dropTablesAndMigrateAll(ctx context.Context, dbURLs []string, migrationsPath string, concurrency int, opts ResetOptions, connect connector) ([]Result, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	results := make([]Result, len(dbURLs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, dbURL := range dbURLs {
+		res := &results[i]
+		res.URL = RedactURL(dbURL)
+		if ctx.Err() == nil {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			res.Err = err
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			res.Err = withConn(ctx, dbURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+				var err error
+				res.Tables, err = resetDatabase(ctx, conn, dbURL, migrationsPath, opts)
+				return err
+			})
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, res := range results {
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", res.URL, res.Err))
+		}
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("reset %d of %d databases failed: %w", len(errs), len(results), errors.Join(errs...))
+	}
+	return results, nil
+}
@@ -0,0 +1,73 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestDropTablesAndMigrateAll(t *testing.T) {
+	errDrop := errors.New("permission denied for table users")
+	conns := map[string]*fakeConn{}
+	for _, db := range []string{"tenant_a", "tenant_b", "tenant_c"} {
+		conns[db] = &fakeConn{rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})}
+	}
+	conns["tenant_b"].execErr = errDrop
+	connect := func(_ context.Context, cfg *pgx.ConnConfig) (closableConn, error) {
+		return conns[cfg.Database], nil
+	}
+	urls := []string{
+		"postgres://u:secret@h:5432/tenant_a",
+		"postgres://u:secret@h:5432/tenant_b",
+		"postgres://u:secret@h:5432/tenant_c",
+	}
+	opts := ResetOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	results, err := dropTablesAndMigrateAll(context.Background(), urls, "", 2, opts, connect)
+	if !errors.Is(err, errDrop) || !strings.Contains(err.Error(), "1 of 3") || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("expected an aggregate error naming the redacted failed database, got %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected a result per database, got %d", len(results))
+	}
+	for i, res := range results {
+		if res.URL != RedactURL(urls[i]) {
+			t.Fatalf("result %d: expected URL %q, got %q", i, RedactURL(urls[i]), res.URL)
+		}
+		failed := i == 1
+		if failed != errors.Is(res.Err, errDrop) || failed != (res.Err != nil) {
+			t.Fatalf("result %d: unexpected error %v", i, res.Err)
+		}
+		if !failed && !slices.Equal(res.Tables, []string{"users"}) {
+			t.Fatalf("result %d: expected users to be dropped, got %v", i, res.Tables)
+		}
+	}
+	for db, conn := range conns {
+		if !conn.closed {
+			t.Fatalf("expected the connection to %s to be closed", db)
+		}
+	}
+
+	// nothing is started once the context is cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	connected := false
+	results, err = dropTablesAndMigrateAll(ctx, urls, "", 2, opts, func(context.Context, *pgx.ConnConfig) (closableConn, error) {
+		connected = true
+		return &fakeConn{}, nil
+	})
+	if !errors.Is(err, context.Canceled) || connected {
+		t.Fatalf("expected no resets after cancellation, got %v (connected %v)", err, connected)
+	}
+	for i, res := range results {
+		if !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("result %d: expected context.Canceled, got %v", i, res.Err)
+		}
+	}
+}
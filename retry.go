@@ -0,0 +1,106 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ConnectWithRetry connects to dbURL, retrying up to maxAttempts times with
+// exponential backoff starting at baseDelay plus jitter. Errors that retrying
+// cannot fix, such as a malformed URL or rejected credentials, are returned
+// immediately. After the last attempt the final connection error is returned.
+func ConnectWithRetry(ctx context.Context, dbURL string, maxAttempts int, baseDelay time.Duration) (*pgx.Conn, error) {
+	cfg, err := PgxConfig(dbURL, TLSOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var conn *pgx.Conn
+	err = retry(ctx, maxAttempts, baseDelay, func(ctx context.Context) error {
+		c, err := pgx.ConnectConfig(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		conn = c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// retry calls fn until it succeeds, returns a non-transient error, or has been
+// called maxAttempts times. Between attempts it sleeps for baseDelay doubled
+// after every attempt, with up to half of each delay randomized, returning
+// early if ctx is cancelled.
+func retry(ctx context.Context, maxAttempts int, baseDelay time.Duration, fn func(context.Context) error) error {
+	return retryIf(ctx, maxAttempts, baseDelay, isTransient, fn)
+}
+
+// retryIf is like retry but retries only errors for which transient returns
+// true.
+func retryIf(ctx context.Context, maxAttempts int, baseDelay time.Duration, transient func(error) bool, fn func(context.Context) error) error {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx); err == nil {
+			return nil
+		}
+		if !transient(err) {
+			return err
+		}
+		if attempt == maxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		delay := backoff(baseDelay, attempt)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before retry number attempt: baseDelay doubled for
+// each earlier attempt, with the upper half randomized to spread out clients
+// that failed together.
+func backoff(baseDelay time.Duration, attempt int) time.Duration {
+	d := baseDelay << min(attempt-1, 30)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(half+1)
+}
+
+// nonTransientCodes are SQLSTATE codes and classes that retrying cannot fix.
+var nonTransientCodes = []string{
+	"28",    // invalid authorization specification, e.g. bad password
+	"3D000", // database does not exist
+	"42501", // insufficient privilege
+}
+
+// isTransient reports whether err may succeed if retried.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrInvalidURL) {
+		return false
+	}
+	code := pgErrCode(err)
+	for _, c := range nonTransientCodes {
+		if code != "" && strings.HasPrefix(code, c) {
+			return false
+		}
+	}
+	return true
+}
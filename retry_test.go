@@ -0,0 +1,73 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestRetry_SucceedsAfterFailures(t *testing.T) {
+	attempts := 0
+	err := retry(context.Background(), 5, time.Millisecond, func(context.Context) error {
+		attempts++
+		if attempts <= 2 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	errRefused := errors.New("connection refused")
+	attempts := 0
+	err := retry(context.Background(), 3, time.Millisecond, func(context.Context) error {
+		attempts++
+		return errRefused
+	})
+	if !errors.Is(err, errRefused) || attempts != 3 {
+		t.Fatalf("expected final error after 3 attempts, got %v after %d", err, attempts)
+	}
+}
+
+func TestRetry_AuthErrorNotRetried(t *testing.T) {
+	attempts := 0
+	err := retry(context.Background(), 5, time.Millisecond, func(context.Context) error {
+		attempts++
+		return &pgconn.PgError{Code: "28P01", Message: "password authentication failed"}
+	})
+	if pgErrCode(err) != "28P01" {
+		t.Fatalf("expected auth error, got %v", err)
+	}
+	if attempts != 1 {
+		t.Fatalf("expected auth error not to be retried, got %d attempts", attempts)
+	}
+}
+
+func TestRetry_ContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := retry(ctx, 5, time.Hour, func(context.Context) error {
+		cancel()
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond} {
+		d := backoff(100*time.Millisecond, attempt)
+		if d < want/2 || d > want {
+			t.Fatalf("backoff attempt %d = %v, want within [%v, %v]", attempt, d, want/2, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrNoRows is returned by ScalarInt, ScalarString and ScalarBool when the
+// query returns no row. It also matches pgx.ErrNoRows.
+var ErrNoRows = errors.New("query returned no rows")
+
+// ScalarInt runs sql with args on conn and returns the single bigint-compatible
+// value of its single row, such as a count(*). A query returning no row fails
+// with ErrNoRows; more than one row, or a value that does not scan into an
+// int64, is an error too.
+func ScalarInt(ctx context.Context, conn Querier, sql string, args ...any) (int64, error) {
+	return scalar[int64](ctx, conn, sql, args...)
+}
+
+// ScalarString is like ScalarInt for a text value, such as a setting read with
+// SHOW.
+func ScalarString(ctx context.Context, conn Querier, sql string, args ...any) (string, error) {
+	return scalar[string](ctx, conn, sql, args...)
+}
+
+// ScalarBool is like ScalarInt for a boolean, such as an EXISTS check.
+func ScalarBool(ctx context.Context, conn Querier, sql string, args ...any) (bool, error) {
+	return scalar[bool](ctx, conn, sql, args...)
+}
+
+// scalar returns the value of the single column of the single row returned
+// by sql.
+func scalar[T any](ctx context.Context, conn dbConn, sql string, args ...any) (T, error) {
+	var v T
+	rows, err := conn.Query(ctx, sql, args...)
+	if err == nil {
+		v, err = pgx.CollectExactlyOneRow(rows, pgx.RowTo[T])
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return v, fmt.Errorf("%w: %w", ErrNoRows, err)
+	}
+	return v, err
+}
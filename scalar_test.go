@@ -0,0 +1,42 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func TestScalar(t *testing.T) {
+	ctx := context.Background()
+	conn := &fakeConn{rows: map[string][][]any{
+		"SELECT count(*) FROM users":   {{int64(42)}},
+		"SHOW server_version":          {{"16.2"}},
+		"SELECT EXISTS (SELECT 1)":     {{true}},
+		"SELECT 1 WHERE false":         nil,
+		"SELECT generate_series(1, 2)": {{int64(1)}, {int64(2)}},
+	}}
+
+	if n, err := ScalarInt(ctx, conn, "SELECT count(*) FROM users"); err != nil || n != 42 {
+		t.Fatalf("ScalarInt: got %d, %v", n, err)
+	}
+	if v, err := ScalarString(ctx, conn, "SHOW server_version"); err != nil || v != "16.2" {
+		t.Fatalf("ScalarString: got %q, %v", v, err)
+	}
+	if ok, err := ScalarBool(ctx, conn, "SELECT EXISTS (SELECT 1)"); err != nil || !ok {
+		t.Fatalf("ScalarBool: got %v, %v", ok, err)
+	}
+
+	_, err := ScalarInt(ctx, conn, "SELECT 1 WHERE false")
+	if !errors.Is(err, ErrNoRows) || !errors.Is(err, pgx.ErrNoRows) {
+		t.Fatalf("expected ErrNoRows, got %v", err)
+	}
+
+	// a value of the wrong type, or a second row, is an error but not ErrNoRows
+	for _, sql := range []string{"SHOW server_version", "SELECT generate_series(1, 2)"} {
+		if _, err := ScalarInt(ctx, conn, sql); err == nil || errors.Is(err, ErrNoRows) {
+			t.Fatalf("%s: expected an error other than ErrNoRows, got %v", sql, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DiffKind says how an object differs between the two sides of SchemaDiff.
+type DiffKind string
+
+const (
+	// DiffOnlyInA is an object that exists only on the first connection.
+	DiffOnlyInA DiffKind = "only in a"
+	// DiffOnlyInB is an object that exists only on the second connection.
+	DiffOnlyInB DiffKind = "only in b"
+	// DiffChanged is an object that exists on both sides with different
+	// definitions.
+	DiffChanged DiffKind = "changed"
+)
+
+// DiffEntry is one difference found by SchemaDiff.
+type DiffEntry struct {
+	Kind DiffKind
+	// Object is "table", "column" or "index".
+	Object string
+	Table  string
+	// Name is the column or index name; empty for a table.
+	Name string
+	// A and B are the object's definitions on each side, empty where it is
+	// missing. A column is described by its type, NOT NULL and default, an
+	// index by its CREATE INDEX statement. Tables have no definition.
+	A, B string
+}
+
+// String describes the difference in one line, e.g.
+// `column users.email changed: "text" vs "character varying(255)"`.
+func (d DiffEntry) String() string {
+	name := d.Table
+	if d.Name != "" {
+		name += "." + d.Name
+	}
+	if d.Kind == DiffChanged {
+		return fmt.Sprintf("%s %s changed: %q vs %q", d.Object, name, d.A, d.B)
+	}
+	return fmt.Sprintf("%s %s %s", d.Object, name, d.Kind)
+}
+
+// SchemaDiff compares the tables, columns and indexes of schema on two
+// databases, e.g. staging and production before a deploy, and returns their
+// differences sorted by table. Data, column order and other kinds of object
+// are not compared. Columns and indexes of a table that exists on one side
+// only are not listed separately. An empty result means the schemas match.
+func SchemaDiff(ctx context.Context, a, b Querier, schema string) ([]DiffEntry, error) {
+	var snapA, snapB *schemaSnapshot
+	err := withSessionConn(ctx, a, func(conn dbConn) error {
+		var err error
+		snapA, err = snapshotSchema(ctx, conn, schema)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema diff: a: %w", err)
+	}
+	err = withSessionConn(ctx, b, func(conn dbConn) error {
+		var err error
+		snapB, err = snapshotSchema(ctx, conn, schema)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("schema diff: b: %w", err)
+	}
+	return diffSchemas(snapA, snapB), nil
+}
+
+// schemaSnapshot holds the definitions SchemaDiff compares, keyed by table
+// and then by column or index name.
+type schemaSnapshot struct {
+	tables  []string
+	columns map[string]map[string]string
+	indexes map[string]map[string]string
+}
+
+// schemaColumnsSQL lists the columns of every table in schema $1.
+const schemaColumnsSQL = `
+SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+       COALESCE(pg_get_expr(d.adbin, d.adrelid), '')
+FROM pg_attribute a
+JOIN pg_class c ON c.oid = a.attrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE n.nspname = $1 AND c.relkind IN ('r', 'p')
+  AND a.attnum > 0 AND NOT a.attisdropped
+ORDER BY c.relname, a.attnum`
+
+// schemaIndexesSQL lists the indexes of every table in schema $1.
+const schemaIndexesSQL = `
+SELECT tablename, indexname, indexdef
+FROM pg_indexes
+WHERE schemaname = $1
+ORDER BY tablename, indexname`
+
+func snapshotSchema(ctx context.Context, conn dbConn, schema string) (*schemaSnapshot, error) {
+	tables, err := listTables(ctx, conn, schema)
+	if err != nil {
+		return nil, err
+	}
+	snap := &schemaSnapshot{
+		tables:  tables,
+		columns: make(map[string]map[string]string),
+		indexes: make(map[string]map[string]string),
+	}
+	add := func(m map[string]map[string]string, table, name, def string) {
+		if m[table] == nil {
+			m[table] = make(map[string]string)
+		}
+		m[table][name] = def
+	}
+
+	rows, err := conn.Query(ctx, schemaColumnsSQL, schema)
+	if err != nil {
+		return nil, fmt.Errorf("list columns: %w", err)
+	}
+	var (
+		table, column, typ, def string
+		notNull                 bool
+	)
+	_, err = pgx.ForEachRow(rows, []any{&table, &column, &typ, &notNull, &def}, func() error {
+		add(snap.columns, table, column, columnDefinition(typ, notNull, def))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list columns: %w", err)
+	}
+
+	rows, err = conn.Query(ctx, schemaIndexesSQL, schema)
+	if err != nil {
+		return nil, fmt.Errorf("list indexes: %w", err)
+	}
+	var index, indexDef string
+	_, err = pgx.ForEachRow(rows, []any{&table, &index, &indexDef}, func() error {
+		add(snap.indexes, table, index, indexDef)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list indexes: %w", err)
+	}
+	return snap, nil
+}
+
+// columnDefinition describes a column the way it would be declared, e.g.
+// "integer NOT NULL DEFAULT 0".
+func columnDefinition(typ string, notNull bool, def string) string {
+	var b strings.Builder
+	b.WriteString(typ)
+	if notNull {
+		b.WriteString(" NOT NULL")
+	}
+	if def != "" {
+		b.WriteString(" DEFAULT " + def)
+	}
+	return b.String()
+}
+
+func diffSchemas(a, b *schemaSnapshot) []DiffEntry {
+	tablesA, tablesB := setOf(a.tables), setOf(b.tables)
+	var diffs []DiffEntry
+	for _, table := range unionKeys(tablesA, tablesB) {
+		inA, inB := tablesA[table], tablesB[table]
+		switch {
+		case !inB:
+			diffs = append(diffs, DiffEntry{Kind: DiffOnlyInA, Object: "table", Table: table})
+			continue
+		case !inA:
+			diffs = append(diffs, DiffEntry{Kind: DiffOnlyInB, Object: "table", Table: table})
+			continue
+		}
+		diffs = append(diffs, diffDefinitions("column", table, a.columns[table], b.columns[table])...)
+		diffs = append(diffs, diffDefinitions("index", table, a.indexes[table], b.indexes[table])...)
+	}
+	return diffs
+}
+
+// diffDefinitions compares the named definitions of one kind of object on a
+// table, in name order.
+func diffDefinitions(object, table string, a, b map[string]string) []DiffEntry {
+	var diffs []DiffEntry
+	for _, name := range unionKeys(a, b) {
+		defA, inA := a[name]
+		defB, inB := b[name]
+		entry := DiffEntry{Object: object, Table: table, Name: name, A: defA, B: defB}
+		switch {
+		case !inB:
+			entry.Kind = DiffOnlyInA
+		case !inA:
+			entry.Kind = DiffOnlyInB
+		case defA != defB:
+			entry.Kind = DiffChanged
+		default:
+			continue
+		}
+		diffs = append(diffs, entry)
+	}
+	return diffs
+}
+
+// unionKeys returns the keys present in either map, sorted.
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := slices.Collect(maps.Keys(a))
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func setOf(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, n := range names {
+		set[n] = true
+	}
+	return set
+}
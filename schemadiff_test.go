@@ -0,0 +1,75 @@
+package psqltoolbox
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// schemaConn returns a fakeConn answering SchemaDiff's catalog queries for
+// the app schema with tables, columns (table, name, type, not null, default)
+// and indexes (table, name, definition).
+func schemaConn(tables []string, columns, indexes [][]any) *fakeConn {
+	var objs []dbObject
+	for _, t := range tables {
+		objs = append(objs, dbObject{Kind: "TABLE", Schema: "app", Name: t})
+	}
+	catalog := catalogRows(objs...)
+	return &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+		switch sql {
+		case schemaColumnsSQL:
+			return columns
+		case schemaIndexesSQL:
+			return indexes
+		}
+		return catalog(sql, args)
+	}}
+}
+
+func TestSchemaDiff(t *testing.T) {
+	usersEmail := "CREATE UNIQUE INDEX users_email_key ON app.users USING btree (email)"
+	a := schemaConn(
+		[]string{"orders", "users"},
+		[][]any{
+			{"orders", "id", "bigint", true, ""},
+			{"users", "id", "bigint", true, ""},
+			{"users", "email", "text", true, ""},
+			{"users", "nickname", "text", false, ""},
+		},
+		[][]any{{"users", "users_email_key", usersEmail}},
+	)
+	b := schemaConn(
+		[]string{"audit_log", "users"},
+		[][]any{
+			{"audit_log", "id", "bigint", true, ""},
+			{"users", "id", "bigint", true, ""},
+			{"users", "email", "character varying(255)", true, ""},
+		},
+		[][]any{{"users", "users_email_key", usersEmail}},
+	)
+
+	diffs, err := SchemaDiff(context.Background(), a, b, "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DiffEntry{
+		{Kind: DiffOnlyInB, Object: "table", Table: "audit_log"},
+		{Kind: DiffOnlyInA, Object: "table", Table: "orders"},
+		{Kind: DiffChanged, Object: "column", Table: "users", Name: "email", A: "text NOT NULL", B: "character varying(255) NOT NULL"},
+		{Kind: DiffOnlyInA, Object: "column", Table: "users", Name: "nickname", A: "text"},
+	}
+	if !reflect.DeepEqual(diffs, want) {
+		t.Fatalf("unexpected diff:\n got %v\nwant %v", diffs, want)
+	}
+	if got := diffs[2].String(); got != `column users.email changed: "text NOT NULL" vs "character varying(255) NOT NULL"` {
+		t.Fatalf("unexpected description %q", got)
+	}
+
+	diffs, err = SchemaDiff(context.Background(), a, a, "app")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected identical schemas to match, got %v", diffs)
+	}
+}
@@ -0,0 +1,59 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// LoadSeeds applies every *.sql file in seedsDir to conn in lexical order, so
+// names like 001_users.sql and 002_orders.sql control the sequence. It is
+// meant to follow DropTablesAndMigrate when resetting a database for tests.
+// Each file runs as with RunSQLFile inside its own transaction, so a failing
+// file leaves none of its rows behind; files before it stay applied. The
+// error names the failing file. A seedsDir that does not exist or is not a
+// directory is an error; a directory without *.sql files loads nothing.
+func LoadSeeds(ctx context.Context, conn Querier, seedsDir string) error {
+	return loadSeeds(ctx, conn, seedsDir)
+}
+
+func loadSeeds(ctx context.Context, conn dbConn, seedsDir string) error {
+	fi, err := os.Stat(seedsDir)
+	if err != nil {
+		return fmt.Errorf("load seeds: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("load seeds: %s is not a directory", seedsDir)
+	}
+	files, err := filepath.Glob(filepath.Join(seedsDir, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("load seeds: %w", err)
+	}
+	slices.Sort(files)
+	for _, path := range files {
+		if err := loadSeedFile(ctx, conn, path); err != nil {
+			return fmt.Errorf("load seeds: %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// loadSeedFile runs the script at path in a transaction on conn.
+func loadSeedFile(ctx context.Context, conn dbConn, path string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	// Rollback after a successful Commit is a no-op.
+	defer tx.Rollback(context.Background())
+
+	if err := runSQLFile(ctx, tx, path); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
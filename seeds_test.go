@@ -0,0 +1,84 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeSeeds(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("write seed %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoadSeeds(t *testing.T) {
+	dir := writeSeeds(t, map[string]string{
+		"002_orders.sql": "INSERT INTO orders VALUES (1, 1);",
+		"001_users.sql":  "INSERT INTO users VALUES (1);\nINSERT INTO users VALUES (2);",
+		"README.md":      "not a seed",
+	})
+
+	conn := &fakeConn{}
+	if err := loadSeeds(context.Background(), conn, dir); err != nil {
+		t.Fatalf("loadSeeds: %v", err)
+	}
+	want := []string{
+		"INSERT INTO users VALUES (1)",
+		"INSERT INTO users VALUES (2)",
+		"INSERT INTO orders VALUES (1, 1)",
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+	if conn.commits != 2 {
+		t.Fatalf("expected a transaction per file, got %d commits", conn.commits)
+	}
+}
+
+// Test that a failing seed file is named in the error and rolled back, after
+// the files before it were committed.
+func TestLoadSeeds_Failure(t *testing.T) {
+	dir := writeSeeds(t, map[string]string{
+		"001_users.sql":  "INSERT INTO users VALUES (1);",
+		"002_orders.sql": "INSERT INTO orders VALUES (1, 1);\nINSERT INTO orders VALUES (2, 99);",
+	})
+
+	conn := &fakeConn{execErrOn: func(sql string) bool { return strings.Contains(sql, "99") }}
+	err := loadSeeds(context.Background(), conn, dir)
+	if err == nil || !strings.Contains(err.Error(), "002_orders.sql") {
+		t.Fatalf("expected error naming 002_orders.sql, got %v", err)
+	}
+	if want := []string{"INSERT INTO users VALUES (1)"}; !slices.Equal(conn.execs, want) {
+		t.Fatalf("executed %v, want %v", conn.execs, want)
+	}
+	if conn.rollbacks != 1 {
+		t.Fatalf("expected the failing file to be rolled back, got %d rollbacks", conn.rollbacks)
+	}
+}
+
+func TestLoadSeeds_MissingDir(t *testing.T) {
+	conn := &fakeConn{}
+	err := loadSeeds(context.Background(), conn, filepath.Join(t.TempDir(), "seeds"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected a missing seeds directory to fail, got %v", err)
+	}
+
+	file := filepath.Join(writeSeeds(t, map[string]string{"001_users.sql": "SELECT 1;"}), "001_users.sql")
+	if err := loadSeeds(context.Background(), conn, file); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Fatalf("expected a seed file passed as the directory to fail, got %v", err)
+	}
+	if conn.execs != nil || conn.commits != 0 {
+		t.Fatalf("expected nothing to run, got %v", conn.execs)
+	}
+}
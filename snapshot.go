@@ -0,0 +1,56 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Snapshot is an exported snapshot returned by ExportSnapshot. It stays
+// valid, and importable by PgDumpOptions.Snapshot, until Close is called.
+type Snapshot struct {
+	// ID is the snapshot identifier returned by pg_export_snapshot, e.g.
+	// "00000003-0000001B-1".
+	ID string
+
+	tx pgx.Tx
+}
+
+// Close ends the transaction holding the snapshot. Dumps that imported it
+// keep their view of the data, so Close can be called once they have
+// started, but a dump started afterwards fails.
+func (s *Snapshot) Close(ctx context.Context) error {
+	if err := s.tx.Rollback(ctx); err != nil {
+		return fmt.Errorf("close snapshot %s: %w", s.ID, err)
+	}
+	return nil
+}
+
+// ExportSnapshot opens a read-only repeatable-read transaction on conn and
+// exports its snapshot with pg_export_snapshot. Passing the ID to several
+// dumps through PgDumpOptions.Snapshot, such as one per schema run in
+// parallel, makes them all see the database as of the same instant. Snapshots
+// can only be imported by sessions on the same database, so dumps of
+// different databases cannot share one. The transaction, and with it conn,
+// stays busy until the returned Snapshot is closed; with a *pgxpool.Pool a
+// connection is held out of the pool for that long.
+func ExportSnapshot(ctx context.Context, conn Querier) (*Snapshot, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("export snapshot: %w", err)
+	}
+	id, err := exportSnapshot(ctx, tx)
+	if err != nil {
+		_ = tx.Rollback(context.WithoutCancel(ctx))
+		return nil, fmt.Errorf("export snapshot: %w", err)
+	}
+	return &Snapshot{ID: id, tx: tx}, nil
+}
+
+func exportSnapshot(ctx context.Context, tx dbConn) (string, error) {
+	if _, err := tx.Exec(ctx, "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY"); err != nil {
+		return "", err
+	}
+	return scalar[string](ctx, tx, "SELECT pg_export_snapshot()")
+}
@@ -0,0 +1,55 @@
+package psqltoolbox
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Test that the exported snapshot id is threaded into pg_dump's --snapshot
+// and that closing the snapshot ends its transaction.
+func TestExportSnapshot_Dump(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{
+		"SELECT pg_export_snapshot()": {{"00000003-0000001B-1"}},
+	}}
+	snap, err := ExportSnapshot(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snap.ID != "00000003-0000001B-1" {
+		t.Fatalf("unexpected snapshot id %q", snap.ID)
+	}
+
+	dir, argsFile := writeArgsRecorder(t, "pg_dump")
+	outFile := filepath.Join(t.TempDir(), "out.dump")
+	opts := PgDumpOptions{Binary: filepath.Join(dir, "pg_dump"), Snapshot: snap.ID}
+	if err := PgDumpToFileWithOptions(context.Background(), "postgres://u:p@h:1234/db", outFile, 5*time.Second, opts); err != nil {
+		t.Fatalf("PgDumpToFileWithOptions failed: %v", err)
+	}
+	if args := readArgs(t, argsFile); !slices.Contains(args, "--snapshot=00000003-0000001B-1") {
+		t.Fatalf("expected --snapshot in pg_dump args, got %v", args)
+	}
+
+	if conn.rollbacks != 0 || conn.commits != 0 {
+		t.Fatalf("expected the snapshot transaction to stay open until Close")
+	}
+	if err := snap.Close(context.Background()); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if conn.rollbacks != 1 {
+		t.Fatalf("expected Close to end the transaction, got %d rollbacks", conn.rollbacks)
+	}
+}
+
+// Test that a failed export does not leave the transaction open.
+func TestExportSnapshot_Error(t *testing.T) {
+	conn := &fakeConn{}
+	if _, err := ExportSnapshot(context.Background(), conn); err == nil {
+		t.Fatalf("expected an error when no snapshot id is returned")
+	}
+	if conn.rollbacks != 1 {
+		t.Fatalf("expected the transaction to be rolled back, got %d rollbacks", conn.rollbacks)
+	}
+}
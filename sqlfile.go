@@ -0,0 +1,237 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// sqlStatement is one statement split out of a script, with the 1-based line
+// it starts on.
+type sqlStatement struct {
+	SQL  string
+	Line int
+}
+
+// RunSQLFile executes the SQL script at path against conn, one statement at a
+// time. Statements are split on semicolons outside of quoted strings, quoted
+// identifiers, dollar-quoted bodies and comments, so function definitions are
+// kept intact. psql meta-commands such as \i are not supported. Errors name
+// the file, line and statement number of the failing statement.
+func RunSQLFile(ctx context.Context, conn Querier, path string) error {
+	return withSessionConn(ctx, conn, func(conn dbConn) error {
+		return runSQLFile(ctx, conn, path)
+	})
+}
+
+// runSQLFile implements RunSQLFile against any dbConn.
+func runSQLFile(ctx context.Context, conn dbConn, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read sql file: %w", err)
+	}
+	for i, stmt := range splitSQL(string(b)) {
+		if _, err := conn.Exec(ctx, stmt.SQL); err != nil {
+			return fmt.Errorf("%s:%d: statement %d: %w", path, stmt.Line, i+1, err)
+		}
+	}
+	return nil
+}
+
+// StatementResult reports how one statement passed to RunSQLTx fared.
+type StatementResult struct {
+	SQL string
+	// RowsAffected is the row count reported by the statement, e.g. for an
+	// UPDATE.
+	RowsAffected int64
+	// Err is the statement's error, or nil if it succeeded.
+	Err error
+}
+
+// stmtSavepoint is the savepoint RunSQLTx sets before each statement.
+const stmtSavepoint = "psqltoolbox_stmt"
+
+// RunSQLTx runs statements in order in a single transaction, for batches such
+// as idempotent fix-up scripts. With stopOnError the first failing statement
+// rolls the whole transaction back and its error is returned. Otherwise each
+// statement runs after a savepoint, a failing one is rolled back to it and
+// the rest still run, and the transaction commits whatever succeeded; the
+// returned error is then nil unless the transaction itself fails. The results
+// cover every statement that was attempted, in order.
+func RunSQLTx(ctx context.Context, conn Querier, statements []string, stopOnError bool) ([]StatementResult, error) {
+	var results []StatementResult
+	err := withSessionConn(ctx, conn, func(conn dbConn) error {
+		var err error
+		results, err = runSQLTx(ctx, conn, statements, stopOnError)
+		return err
+	})
+	return results, err
+}
+
+// runSQLTx implements RunSQLTx against any dbConn.
+func runSQLTx(ctx context.Context, conn dbConn, statements []string, stopOnError bool) ([]StatementResult, error) {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	// Rollback after a successful Commit is a no-op.
+	defer tx.Rollback(context.Background())
+
+	results := make([]StatementResult, 0, len(statements))
+	for i, sql := range statements {
+		if !stopOnError {
+			if _, err := tx.Exec(ctx, "SAVEPOINT "+stmtSavepoint); err != nil {
+				return results, fmt.Errorf("statement %d: savepoint: %w", i+1, err)
+			}
+		}
+		tag, err := tx.Exec(ctx, sql)
+		results = append(results, StatementResult{SQL: sql, RowsAffected: tag.RowsAffected(), Err: err})
+		switch {
+		case err != nil && stopOnError:
+			return results, fmt.Errorf("statement %d: %w (transaction rolled back)", i+1, err)
+		case err != nil:
+			if _, err := tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+stmtSavepoint); err != nil {
+				return results, fmt.Errorf("statement %d: rollback to savepoint: %w", i+1, err)
+			}
+		case !stopOnError:
+			if _, err := tx.Exec(ctx, "RELEASE SAVEPOINT "+stmtSavepoint); err != nil {
+				return results, fmt.Errorf("statement %d: release savepoint: %w", i+1, err)
+			}
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return results, fmt.Errorf("commit: %w", err)
+	}
+	return results, nil
+}
+
+// splitSQL splits script into statements. Comments before a statement are
+// not included in it, and empty or comment-only statements are dropped.
+func splitSQL(script string) []sqlStatement {
+	var (
+		stmts     []sqlStatement
+		start     int  // byte offset of the current statement's first token
+		startLine = 1  // line the current statement begins on
+		line      = 1  // current line
+		hasCode   bool // current statement contains something besides comments
+	)
+	flush := func(end int) {
+		if hasCode {
+			stmts = append(stmts, sqlStatement{SQL: strings.TrimSpace(script[start:end]), Line: startLine})
+		}
+		hasCode = false
+	}
+	// markCode records where a statement starts at its first token, so
+	// leading comments and whitespace are not part of it.
+	markCode := func(i int) {
+		if !hasCode {
+			hasCode = true
+			start, startLine = i, line
+		}
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\n':
+			line++
+		case c == ';':
+			flush(i)
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end - 1 // the newline is counted on the next iteration
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			i = skipBlockComment(script, i, &line)
+		case c == '\'':
+			markCode(i)
+			escapes := i > 0 && (script[i-1] == 'E' || script[i-1] == 'e')
+			i = skipQuoted(script, i, '\'', escapes, &line)
+		case c == '"':
+			markCode(i)
+			i = skipQuoted(script, i, '"', false, &line)
+		case c == '$':
+			markCode(i)
+			if tag, ok := dollarTag(script[i:]); ok {
+				end := strings.Index(script[i+len(tag):], tag)
+				if end < 0 {
+					end = len(script) - i - len(tag)
+				}
+				body := script[i : i+len(tag)+end]
+				line += strings.Count(body, "\n")
+				i += len(body) + len(tag) - 1
+			}
+		case c == ' ' || c == '\t' || c == '\r':
+		default:
+			markCode(i)
+		}
+	}
+	flush(len(script))
+	return stmts
+}
+
+// skipBlockComment returns the index of the final '/' of the (possibly nested)
+// block comment starting at i, counting newlines into line.
+func skipBlockComment(s string, i int, line *int) int {
+	depth := 0
+	for ; i < len(s); i++ {
+		switch {
+		case s[i] == '\n':
+			*line++
+		case strings.HasPrefix(s[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s)
+}
+
+// skipQuoted returns the index of the closing quote of the string or
+// identifier starting at i. Doubled quotes are treated as escaped quotes, as
+// are backslash escapes when escapes is set (E'...' strings).
+func skipQuoted(s string, i int, quote byte, escapes bool, line *int) int {
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\n':
+			*line++
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(s) && s[i+1] == quote {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return len(s)
+}
+
+// dollarTag reports whether s starts with a dollar-quote opening tag such as
+// $$ or $body$ and returns it. Positional parameters like $1 are not tags.
+func dollarTag(s string) (string, bool) {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+		switch {
+		case c == '$':
+			return s[:j+1], true
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80:
+		case c >= '0' && c <= '9' && j > 1:
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
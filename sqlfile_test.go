@@ -0,0 +1,109 @@
+package psqltoolbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testScript = `-- seed data; not a statement
+CREATE TABLE notes (id int, body text);
+
+INSERT INTO notes VALUES (1, 'semi; colon'), (2, 'it''s; fine');
+INSERT INTO notes VALUES (3, E'back\'slash; ok');
+
+CREATE FUNCTION touch() RETURNS trigger AS $body$
+BEGIN
+    NEW.body := NEW.body || ';';
+    RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+
+/* block; /* nested; */ comment */
+SELECT $1::text, "odd;name" FROM notes;
+`
+
+func TestSplitSQL(t *testing.T) {
+	stmts := splitSQL(testScript)
+	want := []sqlStatement{
+		{"CREATE TABLE notes (id int, body text)", 2},
+		{"INSERT INTO notes VALUES (1, 'semi; colon'), (2, 'it''s; fine')", 4},
+		{`INSERT INTO notes VALUES (3, E'back\'slash; ok')`, 5},
+		{"CREATE FUNCTION touch() RETURNS trigger AS $body$\nBEGIN\n    NEW.body := NEW.body || ';';\n    RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql", 7},
+		{`SELECT $1::text, "odd;name" FROM notes`, 15},
+	}
+	if len(stmts) != len(want) {
+		t.Fatalf("got %d statements, want %d: %q", len(stmts), len(want), stmts)
+	}
+	for i := range want {
+		if stmts[i] != want[i] {
+			t.Fatalf("statement %d:\n got %+v\nwant %+v", i+1, stmts[i], want[i])
+		}
+	}
+}
+
+func TestRunSQLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seed.sql")
+	if err := os.WriteFile(path, []byte(testScript), 0o644); err != nil {
+		t.Fatalf("write script: %v", err)
+	}
+
+	conn := &fakeConn{}
+	if err := runSQLFile(context.Background(), conn, path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(conn.execs) != 5 {
+		t.Fatalf("expected 5 statements executed, got %d", len(conn.execs))
+	}
+
+	// failing statements are reported with their location
+	conn = &fakeConn{execErrOn: func(sql string) bool { return strings.HasPrefix(sql, "CREATE FUNCTION") }}
+	err := runSQLFile(context.Background(), conn, path)
+	if err == nil || !strings.Contains(err.Error(), path+":7: statement 4:") {
+		t.Fatalf("expected error naming line 7 statement 4, got %v", err)
+	}
+}
+
+func TestRunSQLTx(t *testing.T) {
+	statements := []string{
+		"UPDATE users SET active = true",
+		"ALTER TABLE users ADD COLUMN nickname text",
+		"CREATE INDEX ON users (email)",
+	}
+	failing := func(sql string) bool { return strings.HasPrefix(sql, "ALTER") }
+
+	// continue mode rolls the failing statement back to its savepoint and
+	// commits the rest
+	conn := &fakeConn{execErrOn: failing}
+	results, err := runSQLTx(context.Background(), conn, statements, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("expected only the second statement to fail, got %+v", results)
+	}
+	want := []string{
+		"SAVEPOINT psqltoolbox_stmt", statements[0], "RELEASE SAVEPOINT psqltoolbox_stmt",
+		"SAVEPOINT psqltoolbox_stmt", "ROLLBACK TO SAVEPOINT psqltoolbox_stmt",
+		"SAVEPOINT psqltoolbox_stmt", statements[2], "RELEASE SAVEPOINT psqltoolbox_stmt",
+	}
+	if !slices.Equal(conn.execs, want) || conn.commits != 1 {
+		t.Fatalf("unexpected committed statements (commits=%d):\n got %q\nwant %q", conn.commits, conn.execs, want)
+	}
+
+	// stop mode rolls everything back at the first failure
+	conn = &fakeConn{execErrOn: failing}
+	results, err = runSQLTx(context.Background(), conn, statements, true)
+	if err == nil || !strings.Contains(err.Error(), "statement 2") {
+		t.Fatalf("expected an error naming statement 2, got %v", err)
+	}
+	if len(results) != 2 || results[0].Err != nil || results[1].Err == nil {
+		t.Fatalf("expected results for the first two statements, got %+v", results)
+	}
+	if conn.commits != 0 || conn.rollbacks != 1 || len(conn.execs) != 0 {
+		t.Fatalf("expected the transaction rolled back, got commits=%d rollbacks=%d execs=%v", conn.commits, conn.rollbacks, conn.execs)
+	}
+}
@@ -0,0 +1,91 @@
+package psqltoolbox
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// TLSOptions overrides the TLS settings taken from a database URL for the
+// connections this package opens itself, such as those of Ping and
+// WaitForDatabaseReady. Managed providers like RDS or Cloud SQL need their CA
+// bundle for sslmode=verify-full; supply it here rather than disabling
+// verification. The zero value leaves the URL's settings alone.
+type TLSOptions struct {
+	// RootCertFile is a PEM file of CA certificates used to verify the
+	// server, as if sslrootcert were set in the URL. The URL's sslmode
+	// still decides how strictly: verify-full checks the chain and the host
+	// name, verify-ca and require only the chain, and prefer or allow not at
+	// all.
+	RootCertFile string
+
+	// Config, when set, replaces the TLS configuration derived from the URL
+	// and makes TLS mandatory: there is no plaintext fallback, whatever the
+	// sslmode. ServerName defaults to each host's name. RootCertFile is
+	// ignored when Config is set.
+	Config *tls.Config
+}
+
+// PgxConfig parses dbURL into a pgx connection config with the TLS overrides
+// in opts applied, for callers that open their own pgx connections or pools
+// with the same settings. application_name defaults to
+// DefaultApplicationName. The URL's security settings, sslmode,
+// sslnegotiation and channel_binding, are applied as libpq applies them.
+// Failures, including an unreadable RootCertFile, wrap ErrInvalidURL.
+func PgxConfig(dbURL string, opts TLSOptions) (*pgx.ConnConfig, error) {
+	if opts.Config == nil && opts.RootCertFile != "" {
+		u, err := url.Parse(dbURL)
+		if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			return nil, fmt.Errorf("%w: a root certificate file needs a postgres:// URL", ErrInvalidURL)
+		}
+		query := u.Query()
+		query.Set("sslrootcert", opts.RootCertFile)
+		u.RawQuery = query.Encode()
+		dbURL = u.String()
+	}
+	cfg, err := pgx.ParseConfig(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+	if opts.Config != nil {
+		applyTLSConfig(cfg, opts.Config)
+	}
+	// pgx has already applied an inherited PGAPPNAME
+	if cfg.RuntimeParams["application_name"] == "" {
+		cfg.RuntimeParams["application_name"] = DefaultApplicationName
+	}
+	return cfg, nil
+}
+
+// applyTLSConfig makes every host in cfg use a copy of tc, dropping the
+// fallbacks that only retried the same server with other TLS settings.
+func applyTLSConfig(cfg *pgx.ConnConfig, tc *tls.Config) {
+	cfg.TLSConfig = serverTLSConfig(tc, cfg.Host)
+	seen := map[string]bool{net.JoinHostPort(cfg.Host, fmt.Sprint(cfg.Port)): true}
+	fallbacks := make([]*pgconn.FallbackConfig, 0, len(cfg.Fallbacks))
+	for _, fb := range cfg.Fallbacks {
+		key := net.JoinHostPort(fb.Host, fmt.Sprint(fb.Port))
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		fb.TLSConfig = serverTLSConfig(tc, fb.Host)
+		fallbacks = append(fallbacks, fb)
+	}
+	cfg.Fallbacks = fallbacks
+}
+
+// serverTLSConfig returns a copy of tc naming host as the server to verify,
+// unless tc already names one.
+func serverTLSConfig(tc *tls.Config, host string) *tls.Config {
+	c := tc.Clone()
+	if c.ServerName == "" && !strings.HasPrefix(host, "/") {
+		c.ServerName = host
+	}
+	return c
+}
@@ -0,0 +1,191 @@
+package psqltoolbox
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// writeRootCert writes a self-signed CA certificate as PEM and returns its
+// path along with the pool a verifier should end up with.
+func writeRootCert(t *testing.T) (string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "root.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return path, pool
+}
+
+func TestPgxConfig_RootCertFile(t *testing.T) {
+	path, pool := writeRootCert(t)
+
+	cfg, err := PgxConfig("postgres://u:p@db.example.com:5432/app?sslmode=verify-full", TLSOptions{RootCertFile: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TLSConfig == nil || cfg.TLSConfig.RootCAs == nil || !cfg.TLSConfig.RootCAs.Equal(pool) {
+		t.Fatalf("expected the root certificate in the TLS config, got %+v", cfg.TLSConfig)
+	}
+	if cfg.TLSConfig.ServerName != "db.example.com" {
+		t.Fatalf("expected the host to be verified, got server name %q", cfg.TLSConfig.ServerName)
+	}
+	if len(cfg.Fallbacks) != 0 {
+		t.Fatalf("expected no plaintext fallback with verify-full, got %d", len(cfg.Fallbacks))
+	}
+
+	// with a root certificate, require verifies the chain like verify-ca
+	cfg, err = PgxConfig("postgres://u:p@db.example.com:5432/app?sslmode=require", TLSOptions{RootCertFile: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.TLSConfig == nil || !cfg.TLSConfig.RootCAs.Equal(pool) || cfg.TLSConfig.VerifyPeerCertificate == nil {
+		t.Fatalf("expected the certificate chain to be verified, got %+v", cfg.TLSConfig)
+	}
+
+	if _, err := PgxConfig("postgres://u:p@h:5432/app", TLSOptions{RootCertFile: filepath.Join(t.TempDir(), "missing.pem")}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for a missing root certificate, got %v", err)
+	}
+	if _, err := PgxConfig("host=h dbname=app", TLSOptions{RootCertFile: path}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for a non-URL connection string, got %v", err)
+	}
+}
+
+func TestPgxConfig_TLSConfig(t *testing.T) {
+	_, pool := writeRootCert(t)
+	tc := &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+
+	for _, mode := range []string{"disable", "prefer", "allow", "verify-full"} {
+		cfg, err := PgxConfig("postgres://u:p@db.example.com:5432/app?sslmode="+mode, TLSOptions{Config: tc})
+		if err != nil {
+			t.Fatalf("sslmode=%s: unexpected error: %v", mode, err)
+		}
+		if cfg.TLSConfig == nil || cfg.TLSConfig == tc || !cfg.TLSConfig.RootCAs.Equal(pool) {
+			t.Fatalf("sslmode=%s: expected a copy of the supplied TLS config, got %+v", mode, cfg.TLSConfig)
+		}
+		if cfg.TLSConfig.ServerName != "db.example.com" {
+			t.Fatalf("sslmode=%s: expected server name db.example.com, got %q", mode, cfg.TLSConfig.ServerName)
+		}
+		if len(cfg.Fallbacks) != 0 {
+			t.Fatalf("sslmode=%s: expected no fallbacks for a single host, got %d", mode, len(cfg.Fallbacks))
+		}
+	}
+	if tc.ServerName != "" {
+		t.Fatalf("expected the caller's TLS config to be left alone")
+	}
+
+	// every host of a multi-host URL is verified under its own name
+	cfg, err := PgxConfig("postgres://u:p@a.example.com:5432,b.example.com:5433/app", TLSOptions{Config: tc})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.Fallbacks) != 1 || cfg.Fallbacks[0].Host != "b.example.com" || cfg.Fallbacks[0].TLSConfig.ServerName != "b.example.com" {
+		t.Fatalf("expected one TLS fallback for b.example.com, got %+v", cfg.Fallbacks)
+	}
+}
+
+func TestPgxConfig_SecurityParams(t *testing.T) {
+	const base = "postgres://u:p@db.example.com:5432/app?sslmode=require&sslnegotiation=direct"
+
+	for _, mode := range []string{"disable", "prefer", "require"} {
+		cfg, err := PgxConfig(base+"&channel_binding="+mode, TLSOptions{})
+		if err != nil {
+			t.Fatalf("channel_binding=%s: unexpected error: %v", mode, err)
+		}
+		if cfg.ChannelBinding != mode {
+			t.Fatalf("expected channel_binding=%s to survive into the pgx config, got %q", mode, cfg.ChannelBinding)
+		}
+		if cfg.TLSConfig == nil || cfg.SSLNegotiation != "direct" {
+			t.Fatalf("expected sslmode and sslnegotiation to be applied, got TLS %v and negotiation %q", cfg.TLSConfig, cfg.SSLNegotiation)
+		}
+		if _, ok := cfg.RuntimeParams["channel_binding"]; ok {
+			t.Fatalf("expected channel_binding not to be sent to the server as a setting, got %v", cfg.RuntimeParams)
+		}
+	}
+	if _, err := PgxConfig(base+"&channel_binding=maybe", TLSOptions{}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected an invalid channel_binding to fail, got %v", err)
+	}
+
+	// the TLS overrides keep it
+	_, pool := writeRootCert(t)
+	cfg, err := PgxConfig(base+"&channel_binding=require", TLSOptions{Config: &tls.Config{RootCAs: pool}})
+	if err != nil || cfg.ChannelBinding != "require" {
+		t.Fatalf("expected channel_binding=require with a TLS config, got %v, %v", cfg, err)
+	}
+
+	// the client tools use libpq, which enforces channel_binding itself
+	c, err := ParseConnConfig(base + "&channel_binding=require")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	env := c.toolEnv(nil)
+	for _, want := range []string{"PGCHANNELBINDING=require", "PGSSLNEGOTIATION=direct", "PGSSLMODE=require"} {
+		if !slices.Contains(env, want) {
+			t.Fatalf("expected %s in the tool environment", want)
+		}
+	}
+}
+
+// Test that Ping and the readiness probe connect with the TLS overrides.
+func TestPing_TLSOptions(t *testing.T) {
+	path, pool := writeRootCert(t)
+	conn := &fakeConn{rows: map[string][][]any{"SELECT 1": {{int64(1)}}}}
+	var got []*pgx.ConnConfig
+	connect := func(_ context.Context, cfg *pgx.ConnConfig) (closableConn, error) {
+		got = append(got, cfg)
+		return conn, nil
+	}
+
+	const dbURL = "postgres://u:p@db.example.com:5432/app?sslmode=verify-full"
+	if err := ping(context.Background(), dbURL, TLSOptions{RootCertFile: path}, connect); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := readyProbe(context.Background(), dbURL, TLSOptions{RootCertFile: path}, connect, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 connections, got %d", len(got))
+	}
+	for _, cfg := range got {
+		if cfg.TLSConfig == nil || !cfg.TLSConfig.RootCAs.Equal(pool) {
+			t.Fatalf("expected the root certificate to reach the connector, got %+v", cfg.TLSConfig)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ToolInfo describes one client tool as found by DetectTools.
+type ToolInfo struct {
+	// Path is the executable found in PATH; empty when the tool is missing.
+	Path string
+	// Version is the version the tool reports, e.g. "16.2" for pg_dump or
+	// "v4.18.1" for migrate.
+	Version string
+	// Err is why the tool cannot be used: ErrBinaryNotFound when it is
+	// missing, or the failure of its version command.
+	Err error
+}
+
+// Found reports whether the tool was found in PATH.
+func (t ToolInfo) Found() bool {
+	return t.Path != ""
+}
+
+// ToolReport lists the client tools this package runs and what DetectTools
+// learned about each.
+type ToolReport struct {
+	PgDump    ToolInfo
+	PgRestore ToolInfo
+	PgDumpAll ToolInfo
+	Migrate   ToolInfo
+}
+
+// Missing returns the names of the tools that were not found in PATH.
+func (r *ToolReport) Missing() []string {
+	var missing []string
+	for _, t := range r.tools() {
+		if !t.info.Found() {
+			missing = append(missing, t.name)
+		}
+	}
+	return missing
+}
+
+// tools pairs each field of r with the name of its tool, in the order
+// DetectTools probes them.
+func (r *ToolReport) tools() []struct {
+	name string
+	info *ToolInfo
+} {
+	return []struct {
+		name string
+		info *ToolInfo
+	}{
+		{"pg_dump", &r.PgDump},
+		{"pg_restore", &r.PgRestore},
+		{"pg_dumpall", &r.PgDumpAll},
+		{"migrate", &r.Migrate},
+	}
+}
+
+// DetectTools looks up pg_dump, pg_restore, pg_dumpall and migrate in PATH
+// and asks each one found for its version, e.g. as a startup self-check that
+// reports missing tooling before any workflow needs it. A missing tool or a
+// failing version command is recorded in the report rather than returned;
+// the error is only set when ctx ends before every tool was probed.
+func DetectTools(ctx context.Context) (*ToolReport, error) {
+	report := &ToolReport{}
+	for _, t := range report.tools() {
+		if err := ctx.Err(); err != nil {
+			return report, fmt.Errorf("detect tools: %w", err)
+		}
+		bin, err := lookupBinary("", t.name, nil)
+		if err != nil {
+			t.info.Err = err
+			continue
+		}
+		t.info.Path = bin
+		if t.name == "migrate" {
+			t.info.Version, t.info.Err = migrateVersion(ctx, bin)
+		} else {
+			t.info.Version, t.info.Err = pgToolVersion(ctx, nil, bin, t.name)
+		}
+	}
+	return report, nil
+}
+
+// migrateVersion returns the version reported by `bin -version`, which
+// golang-migrate prints to stderr.
+func migrateVersion(ctx context.Context, bin string) (string, error) {
+	var out bytes.Buffer
+	if err := (ExecRunner{}).Run(ctx, bin, []string{"-version"}, nil, &out, &out); err != nil {
+		return "", fmt.Errorf("migrate -version: %w", err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
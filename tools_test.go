@@ -0,0 +1,50 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestDetectTools(t *testing.T) {
+	dir := t.TempDir()
+	scripts := map[string]string{
+		"pg_dump":    "echo 'pg_dump (PostgreSQL) 16.2 (Ubuntu 16.2-1)'",
+		"pg_restore": "echo 'pg_restore (PostgreSQL) 15.6'",
+		"migrate":    "echo v4.18.1 >&2",
+	}
+	for name, body := range scripts {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// only the fakes are in PATH, so pg_dumpall is missing
+	t.Setenv("PATH", dir)
+
+	report, err := DetectTools(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		name    string
+		info    ToolInfo
+		version string
+	}{
+		{"pg_dump", report.PgDump, "16.2 (Ubuntu 16.2-1)"},
+		{"pg_restore", report.PgRestore, "15.6"},
+		{"migrate", report.Migrate, "v4.18.1"},
+	} {
+		if c.info.Err != nil || c.info.Path != filepath.Join(dir, c.name) || c.info.Version != c.version {
+			t.Fatalf("%s: expected version %q at %s, got %+v", c.name, c.version, filepath.Join(dir, c.name), c.info)
+		}
+	}
+	if report.PgDumpAll.Found() || report.PgDumpAll.Version != "" || !errors.Is(report.PgDumpAll.Err, ErrBinaryNotFound) {
+		t.Fatalf("expected pg_dumpall to be reported missing, got %+v", report.PgDumpAll)
+	}
+	if got := report.Missing(); !slices.Equal(got, []string{"pg_dumpall"}) {
+		t.Fatalf("expected only pg_dumpall to be missing, got %v", got)
+	}
+}
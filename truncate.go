@@ -0,0 +1,54 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TruncateAllTables empties every table in schema with a single TRUNCATE ...
+// CASCADE, which handles foreign keys between them and is much faster than
+// DropTablesAndMigrate when only the data needs resetting, e.g. between
+// tests. golang-migrate's schema_migrations table is left alone so the
+// database still counts as migrated. With restartIdentity, sequences owned by
+// the truncated columns start over (RESTART IDENTITY). A schema without
+// tables is not an error.
+func TruncateAllTables(ctx context.Context, conn Querier, schema string, restartIdentity bool) error {
+	return truncateAllTables(ctx, conn, schema, restartIdentity)
+}
+
+func truncateAllTables(ctx context.Context, conn dbConn, schema string, restartIdentity bool) error {
+	tables, err := listTables(ctx, conn, schema)
+	if err != nil {
+		return fmt.Errorf("truncate tables: %w", err)
+	}
+	sql := truncateSQL(schema, tables, restartIdentity)
+	if sql == "" {
+		return nil
+	}
+	if _, err := conn.Exec(ctx, sql); err != nil {
+		return fmt.Errorf("truncate tables: %w", err)
+	}
+	return nil
+}
+
+// truncateSQL builds the TRUNCATE statement for the tables in schema other
+// than schema_migrations, or returns "" when there are none.
+func truncateSQL(schema string, tables []string, restartIdentity bool) string {
+	var names []string
+	for _, t := range tables {
+		if t != "schema_migrations" {
+			names = append(names, pgx.Identifier{schema, t}.Sanitize())
+		}
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	sql := "TRUNCATE " + strings.Join(names, ", ")
+	if restartIdentity {
+		sql += " RESTART IDENTITY"
+	}
+	return sql + " CASCADE"
+}
@@ -0,0 +1,49 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// Test that the tables of one schema, FK-related or not, are emptied by a
+// single TRUNCATE, keeping schema_migrations and other schemas' tables.
+func TestTruncateAllTables(t *testing.T) {
+	conn := &fakeConn{rowsFor: catalogRows(
+		dbObject{Kind: "TABLE", Schema: "app", Name: "orders"},
+		dbObject{Kind: "TABLE", Schema: "app", Name: "users"},
+		dbObject{Kind: "TABLE", Schema: "app", Name: "schema_migrations"},
+		dbObject{Kind: "TABLE", Schema: "audit", Name: "events"},
+	)}
+	ctx := context.Background()
+	if err := truncateAllTables(ctx, conn, "app", true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := truncateAllTables(ctx, conn, "app", false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{
+		`TRUNCATE "app"."orders", "app"."users" RESTART IDENTITY CASCADE`,
+		`TRUNCATE "app"."orders", "app"."users" CASCADE`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("got statements %q, want %q", conn.execs, want)
+	}
+
+	conn = &fakeConn{}
+	if err := truncateAllTables(ctx, conn, "empty", true); err != nil {
+		t.Fatalf("unexpected error for a schema without tables: %v", err)
+	}
+	if len(conn.execs) != 0 {
+		t.Fatalf("expected nothing to run, got %q", conn.execs)
+	}
+
+	conn = &fakeConn{
+		rowsFor: catalogRows(dbObject{Kind: "TABLE", Schema: "app", Name: "users"}),
+		execErr: errors.New("boom"),
+	}
+	if err := truncateAllTables(ctx, conn, "app", true); err == nil {
+		t.Fatalf("expected error from failing TRUNCATE")
+	}
+}
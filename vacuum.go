@@ -0,0 +1,50 @@
+package psqltoolbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// VacuumAnalyze runs VACUUM (ANALYZE), or VACUUM (FULL, ANALYZE) when full is
+// set, to refresh planner statistics after a bulk load such as a restore. By
+// default every table in the database is processed; tables limits it to the
+// named tables, which may be schema-qualified as schema.table. VACUUM cannot
+// run inside a transaction block, so conn must not have one open.
+func VacuumAnalyze(ctx context.Context, conn Querier, full bool, tables ...string) error {
+	return vacuumAnalyze(ctx, conn, full, tables)
+}
+
+func vacuumAnalyze(ctx context.Context, conn dbConn, full bool, tables []string) error {
+	if _, err := conn.Exec(ctx, vacuumSQL(full, tables)); err != nil {
+		return fmt.Errorf("vacuum analyze: %w", err)
+	}
+	return nil
+}
+
+// vacuumSQL builds the VACUUM statement for vacuumAnalyze.
+func vacuumSQL(full bool, tables []string) string {
+	sql := "VACUUM (ANALYZE)"
+	if full {
+		sql = "VACUUM (FULL, ANALYZE)"
+	}
+	if len(tables) == 0 {
+		return sql
+	}
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = qualifiedIdentifier(t).Sanitize()
+	}
+	return sql + " " + strings.Join(names, ", ")
+}
+
+// qualifiedIdentifier splits a table name of the form schema.table, as
+// returned by DropTablesAndMigrateWithOptions, into an identifier.
+func qualifiedIdentifier(name string) pgx.Identifier {
+	if schema, table, ok := strings.Cut(name, "."); ok {
+		return pgx.Identifier{schema, table}
+	}
+	return pgx.Identifier{name}
+}
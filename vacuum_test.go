@@ -0,0 +1,31 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestVacuumAnalyze(t *testing.T) {
+	ctx := context.Background()
+	conn := &fakeConn{}
+	if err := vacuumAnalyze(ctx, conn, false, nil); err != nil {
+		t.Fatalf("vacuumAnalyze: %v", err)
+	}
+	if err := vacuumAnalyze(ctx, conn, true, []string{"users", "audit.events"}); err != nil {
+		t.Fatalf("vacuumAnalyze: %v", err)
+	}
+	want := []string{
+		`VACUUM (ANALYZE)`,
+		`VACUUM (FULL, ANALYZE) "users", "audit"."events"`,
+	}
+	if !slices.Equal(conn.execs, want) {
+		t.Fatalf("got statements %q, want %q", conn.execs, want)
+	}
+
+	conn = &fakeConn{execErr: errors.New("boom")}
+	if err := vacuumAnalyze(ctx, conn, false, nil); err == nil {
+		t.Fatalf("expected error from failing VACUUM")
+	}
+}
@@ -0,0 +1,134 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// DefaultVerifyTimeout bounds the restore done by VerifyDump unless the caller
+// sets a different timeout.
+const DefaultVerifyTimeout = time.Hour
+
+// verifyCleanupTimeout bounds dropping the scratch database, which happens even
+// when the caller's context is already done.
+const verifyCleanupTimeout = 30 * time.Second
+
+// ErrDumpMismatch is returned by VerifyDumpWithOptions when the restored
+// tables or row counts differ from the source database.
+var ErrDumpMismatch = errors.New("restored dump does not match source")
+
+// VerifyDumpOptions controls how VerifyDumpWithOptions checks a dump.
+// The zero value matches VerifyDump.
+type VerifyDumpOptions struct {
+	// Restore is passed to pg_restore. Its PasswordOptional also applies to
+	// scratchAdminURL.
+	Restore PgRestoreOptions
+
+	// Timeout bounds the restore. Defaults to DefaultVerifyTimeout when
+	// zero.
+	Timeout time.Duration
+
+	// SourceURL, when set, is the database the dump was taken from. The
+	// tables in Schema and their exact row counts are compared against the
+	// restored copy, so the source should not have changed since the dump.
+	SourceURL string
+	// Schema is the schema compared when SourceURL is set. Defaults to
+	// public.
+	Schema string
+}
+
+// VerifyDump checks that dumpFile can actually be restored: it creates
+// scratchDBName through the maintenance database in scratchAdminURL, restores
+// the dump into it with pg_restore and drops it again. The scratch database
+// is dropped even when the restore fails.
+func VerifyDump(ctx context.Context, dumpFile, scratchAdminURL, scratchDBName string) error {
+	return VerifyDumpWithOptions(ctx, dumpFile, scratchAdminURL, scratchDBName, VerifyDumpOptions{})
+}
+
+// VerifyDumpWithOptions is like VerifyDump but lets the caller control the
+// restore, and optionally compare against the source, through opts.
+func VerifyDumpWithOptions(ctx context.Context, dumpFile, scratchAdminURL, scratchDBName string, opts VerifyDumpOptions) error {
+	return verifyDump(ctx, dumpFile, scratchAdminURL, scratchDBName, opts, pgxConnect)
+}
+
+func verifyDump(ctx context.Context, dumpFile, adminURL, scratchDBName string, opts VerifyDumpOptions, connect connector) (err error) {
+	cfg, err := ParseConnConfigWithOptions(adminURL, ParseOptions{PasswordOptional: opts.Restore.PasswordOptional})
+	if err != nil {
+		return fmt.Errorf("parse admin url: %w", err)
+	}
+	cfg.Database = scratchDBName
+	scratchURL := cfg.String()
+
+	if err := createDatabase(ctx, adminURL, scratchDBName, connect); err != nil {
+		return fmt.Errorf("verify dump: %w", err)
+	}
+	defer func() {
+		cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), verifyCleanupTimeout)
+		defer cancel()
+		if derr := dropDatabase(cctx, adminURL, scratchDBName, DropDatabaseOptions{Force: true}, connect); derr != nil {
+			err = errors.Join(err, fmt.Errorf("verify dump: clean up: %w", derr))
+		}
+	}()
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultVerifyTimeout
+	}
+	if err := PgRestoreFromFileWithOptions(ctx, scratchURL, dumpFile, timeout, opts.Restore); err != nil {
+		return fmt.Errorf("verify dump %s: %w", dumpFile, err)
+	}
+
+	if opts.SourceURL == "" {
+		return nil
+	}
+	schema := opts.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	want, err := countRowsAt(ctx, opts.SourceURL, schema, connect)
+	if err != nil {
+		return fmt.Errorf("verify dump: source: %w", err)
+	}
+	got, err := countRowsAt(ctx, scratchURL, schema, connect)
+	if err != nil {
+		return fmt.Errorf("verify dump: scratch: %w", err)
+	}
+	return compareRowCounts(want, got)
+}
+
+// countRowsAt returns ExactRowCounts for schema in the database at dbURL.
+func countRowsAt(ctx context.Context, dbURL, schema string, connect connector) (counts map[string]int64, err error) {
+	err = withConn(ctx, dbURL, 0, connect, func(ctx context.Context, conn closableConn) error {
+		counts, err = exactRowCounts(ctx, conn, schema)
+		return err
+	})
+	return counts, err
+}
+
+// compareRowCounts reports every table whose restored row count differs from
+// the source, including tables missing on either side, as ErrDumpMismatch.
+func compareRowCounts(source, restored map[string]int64) error {
+	var diffs []error
+	for _, tbl := range slices.Sorted(maps.Keys(source)) {
+		n, ok := restored[tbl]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Errorf("table %s is missing", tbl))
+		case n != source[tbl]:
+			diffs = append(diffs, fmt.Errorf("table %s has %d rows, want %d", tbl, n, source[tbl]))
+		}
+	}
+	for _, tbl := range slices.Sorted(maps.Keys(restored)) {
+		if _, ok := source[tbl]; !ok {
+			diffs = append(diffs, fmt.Errorf("table %s is not in the source", tbl))
+		}
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("%w: %w", ErrDumpMismatch, errors.Join(diffs...))
+	}
+	return nil
+}
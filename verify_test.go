@@ -0,0 +1,104 @@
+package psqltoolbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// connectByDatabase returns a connector handing out the fake for the database
+// named in the config.
+func connectByDatabase(t *testing.T, conns map[string]*fakeConn) connector {
+	return func(_ context.Context, cfg *pgx.ConnConfig) (closableConn, error) {
+		conn, ok := conns[cfg.Database]
+		if !ok {
+			t.Fatalf("unexpected connection to %q", cfg.Database)
+		}
+		return conn, nil
+	}
+}
+
+func writeFakeRestore(t *testing.T, exitCode string) (dir, argsFile string) {
+	t.Helper()
+	dir = t.TempDir()
+	argsFile = filepath.Join(dir, "args")
+	script := "#!/usr/bin/env bash\nprintf '%s\\n' \"$@\" > \"" + argsFile + "\"\nexit " + exitCode + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "pg_restore"), []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_restore: %v", err)
+	}
+	return dir, argsFile
+}
+
+func TestVerifyDump(t *testing.T) {
+	dir, argsFile := writeFakeRestore(t, "0")
+	admin := &fakeConn{}
+	connect := connectByDatabase(t, map[string]*fakeConn{"postgres": admin})
+
+	withPathPrepended(dir, func() {
+		err := verifyDump(context.Background(), "backup.dump", "postgres://u:p@h:5432/postgres", "verify_scratch", VerifyDumpOptions{}, connect)
+		if err != nil {
+			t.Fatalf("verifyDump: %v", err)
+		}
+	})
+	want := []string{`CREATE DATABASE "verify_scratch"`, `DROP DATABASE "verify_scratch" WITH (FORCE)`}
+	if !slices.Equal(admin.execs, want) {
+		t.Fatalf("executed %v, want %v", admin.execs, want)
+	}
+	if db, _ := flagValue(readArgs(t, argsFile), "-d"); db != "verify_scratch" {
+		t.Fatalf("expected restore into verify_scratch, got %q", db)
+	}
+}
+
+// Test that the scratch database is dropped when pg_restore fails.
+func TestVerifyDump_RestoreFailureCleansUp(t *testing.T) {
+	dir, _ := writeFakeRestore(t, "1")
+	admin := &fakeConn{}
+	connect := connectByDatabase(t, map[string]*fakeConn{"postgres": admin})
+
+	withPathPrepended(dir, func() {
+		err := verifyDump(context.Background(), "backup.dump", "postgres://u:p@h:5432/postgres", "verify_scratch", VerifyDumpOptions{}, connect)
+		if !errors.Is(err, ErrRestoreFailed) {
+			t.Fatalf("expected ErrRestoreFailed, got %v", err)
+		}
+	})
+	if len(admin.execs) != 2 || admin.execs[1] != `DROP DATABASE "verify_scratch" WITH (FORCE)` {
+		t.Fatalf("expected scratch database to be dropped, got %v", admin.execs)
+	}
+}
+
+// Test that row counts are compared against the source when requested.
+func TestVerifyDump_CompareRowCounts(t *testing.T) {
+	dir, _ := writeFakeRestore(t, "0")
+	countsConn := func(users int64) *fakeConn {
+		catalog := catalogRows(dbObject{Kind: "TABLE", Schema: "public", Name: "users"})
+		return &fakeConn{rowsFor: func(sql string, args []any) [][]any {
+			if sql == `SELECT count(*) FROM "public"."users"` {
+				return [][]any{{users}}
+			}
+			return catalog(sql, args)
+		}}
+	}
+	opts := VerifyDumpOptions{SourceURL: "postgres://u:p@src:5432/app"}
+
+	for _, c := range []struct {
+		restored int64
+		wantErr  error
+	}{{42, nil}, {41, ErrDumpMismatch}} {
+		connect := connectByDatabase(t, map[string]*fakeConn{
+			"postgres":       {},
+			"app":            countsConn(42),
+			"verify_scratch": countsConn(c.restored),
+		})
+		withPathPrepended(dir, func() {
+			err := verifyDump(context.Background(), "backup.dump", "postgres://u:p@h:5432/postgres", "verify_scratch", opts, connect)
+			if !errors.Is(err, c.wantErr) || (c.wantErr == nil && err != nil) {
+				t.Fatalf("restored %d rows: expected %v, got %v", c.restored, c.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package psqltoolbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pgVersion is a PostgreSQL major version. Before PostgreSQL 10 the major
+// version had two parts (9.6); from 10 on it is a single number and Minor is 0.
+type pgVersion struct {
+	Major, Minor int
+	Raw          string
+}
+
+func (v pgVersion) String() string {
+	return v.Raw
+}
+
+// olderThan reports whether v is an older major version than other.
+func (v pgVersion) olderThan(other pgVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	return v.Minor < other.Minor
+}
+
+var versionRe = regexp.MustCompile(`(\d+)(?:\.(\d+))?`)
+
+// parsePGVersion extracts the major version from strings such as "16.2",
+// "9.6.24", "17beta1" or "pg_dump (PostgreSQL) 14.9 (Ubuntu 14.9-1)".
+func parsePGVersion(s string) (pgVersion, error) {
+	m := versionRe.FindStringSubmatch(s)
+	if m == nil {
+		return pgVersion{}, fmt.Errorf("no version number in %q", s)
+	}
+	v := pgVersion{Raw: m[0]}
+	v.Major, _ = strconv.Atoi(m[1])
+	if v.Major < 10 && m[2] != "" {
+		v.Minor, _ = strconv.Atoi(m[2])
+	}
+	return v, nil
+}
+
+// CheckDumpCompatibility verifies that the pg_dump on PATH can dump the server
+// described by dbURL. pg_dump refuses to dump from a newer server major
+// version, and fails late when it does; this check fails early with an error
+// naming both versions.
+func CheckDumpCompatibility(ctx context.Context, dbURL string) error {
+	return CheckDumpCompatibilityWithOptions(ctx, dbURL, PgDumpOptions{})
+}
+
+// CheckDumpCompatibilityWithOptions is like CheckDumpCompatibility but checks
+// the pg_dump that a dump with opts would run, i.e. opts.Binary through
+// opts.Runner, such as a versioned binary outside PATH. Only those two fields
+// are used.
+func CheckDumpCompatibilityWithOptions(ctx context.Context, dbURL string, opts PgDumpOptions) error {
+	return checkDumpCompatibility(ctx, opts, func(ctx context.Context) (string, error) {
+		return serverVersionAt(ctx, dbURL, pgxConnect)
+	})
+}
+
+// CheckDumpCompatibilityConn is like CheckDumpCompatibility but asks an
+// existing connection for the server version. The caller keeps ownership of
+// conn.
+func CheckDumpCompatibilityConn(ctx context.Context, conn Querier) error {
+	return CheckDumpCompatibilityConnWithOptions(ctx, conn, PgDumpOptions{})
+}
+
+// CheckDumpCompatibilityConnWithOptions is like CheckDumpCompatibilityConn
+// but checks the pg_dump given by opts, as CheckDumpCompatibilityWithOptions
+// does.
+func CheckDumpCompatibilityConnWithOptions(ctx context.Context, conn Querier, opts PgDumpOptions) error {
+	return checkDumpCompatibility(ctx, opts, func(ctx context.Context) (string, error) {
+		return serverVersion(ctx, conn)
+	})
+}
+
+// pgDumpVersion returns the version reported by `bin --version` run through
+// runner, such as "16.2 (Ubuntu 16.2-1.pgdg22.04+1)".
+func pgDumpVersion(ctx context.Context, runner CommandRunner, bin string) (string, error) {
+	return pgToolVersion(ctx, runner, bin, "pg_dump")
+}
+
+// pgToolVersion is pgDumpVersion for any PostgreSQL client tool, name being
+// the tool's own name as it prints it, e.g. "pg_restore (PostgreSQL) 16.2".
+func pgToolVersion(ctx context.Context, runner CommandRunner, bin, name string) (string, error) {
+	var out bytes.Buffer
+	if err := runnerOrDefault(runner).Run(ctx, bin, []string{"--version"}, nil, &out, io.Discard); err != nil {
+		return "", fmt.Errorf("%s --version: %w", name, err)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(out.String()), name+" (PostgreSQL)")), nil
+}
+
+// serverVersion returns the server_version setting reported by conn.
+func serverVersion(ctx context.Context, conn dbConn) (string, error) {
+	v, err := scalar[string](ctx, conn, "SHOW server_version")
+	if err != nil {
+		return "", fmt.Errorf("query server version: %w", err)
+	}
+	return v, nil
+}
+
+// checkDumpCompatibility compares the version of the pg_dump binary in opts
+// with the version returned by serverVersion.
+func checkDumpCompatibility(ctx context.Context, opts PgDumpOptions, serverVersion func(context.Context) (string, error)) error {
+	bin, err := toolBinary(opts.Runner, opts.Binary, "pg_dump", nil)
+	if err != nil {
+		return err
+	}
+	raw, err := pgDumpVersion(ctx, opts.Runner, bin)
+	if err != nil {
+		return err
+	}
+	client, err := parsePGVersion(raw)
+	if err != nil {
+		return fmt.Errorf("parse pg_dump version: %w", err)
+	}
+
+	raw, err = serverVersion(ctx)
+	if err != nil {
+		return err
+	}
+	server, err := parsePGVersion(raw)
+	if err != nil {
+		return fmt.Errorf("parse server version: %w", err)
+	}
+
+	if client.olderThan(server) {
+		return fmt.Errorf("pg_dump version %s is older than server version %s; install pg_dump %s or newer", client, server, server)
+	}
+	return nil
+}
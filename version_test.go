@@ -0,0 +1,83 @@
+package psqltoolbox
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePGVersion(t *testing.T) {
+	cases := map[string]pgVersion{
+		"16.2 (Debian 16.2-1.pgdg120+2)": {16, 0, "16.2"},
+		"9.6.24":                         {9, 6, "9.6"},
+		"17beta1":                        {17, 0, "17"},
+		"pg_dump (PostgreSQL) 14.9 (Ubuntu 14.9)": {14, 0, "14.9"},
+	}
+	for in, want := range cases {
+		got, err := parsePGVersion(in)
+		if err != nil || got != want {
+			t.Fatalf("parsePGVersion(%q) = %+v, %v; want %+v", in, got, err, want)
+		}
+	}
+	if _, err := parsePGVersion("unknown"); err == nil {
+		t.Fatalf("expected error for missing version")
+	}
+}
+
+func TestCheckDumpCompatibility(t *testing.T) {
+	tmpdir := t.TempDir()
+	fake := filepath.Join(tmpdir, "pg_dump")
+	script := "#!/usr/bin/env bash\necho 'pg_dump (PostgreSQL) 14.9 (Ubuntu 14.9-0ubuntu0.22.04.1)'\n"
+	if err := os.WriteFile(fake, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake pg_dump: %v", err)
+	}
+	server := func(v string) func(context.Context) (string, error) {
+		return func(context.Context) (string, error) { return v, nil }
+	}
+
+	for _, ok := range []string{"14.2", "13.11", "9.6.24"} {
+		if err := checkDumpCompatibility(context.Background(), PgDumpOptions{Binary: fake}, server(ok)); err != nil {
+			t.Fatalf("server %s: unexpected error: %v", ok, err)
+		}
+	}
+
+	err := checkDumpCompatibility(context.Background(), PgDumpOptions{Binary: fake}, server("16.2 (Debian 16.2-1.pgdg120+2)"))
+	if err == nil {
+		t.Fatalf("expected error for newer server")
+	}
+	if !strings.Contains(err.Error(), "14.9") || !strings.Contains(err.Error(), "16.2") {
+		t.Fatalf("expected error to name both versions, got %v", err)
+	}
+}
+
+// Test that the public checks use the pg_dump given in the options rather
+// than the one on PATH.
+func TestCheckDumpCompatibilityConnWithOptions(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{"SHOW server_version": {{"16.2"}}}}
+	runner := versionRunner("16.4")
+	opts := PgDumpOptions{Binary: "/usr/lib/postgresql/16/bin/pg_dump", Runner: runner}
+	if err := CheckDumpCompatibilityConnWithOptions(context.Background(), conn, opts); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.calls) != 1 || runner.calls[0].name != opts.Binary {
+		t.Fatalf("expected %s to be asked for its version, got %+v", opts.Binary, runner.calls)
+	}
+
+	opts.Runner = versionRunner("15.6")
+	if err := CheckDumpCompatibilityConnWithOptions(context.Background(), conn, opts); err == nil || !strings.Contains(err.Error(), "15.6") {
+		t.Fatalf("expected an error naming the older pg_dump, got %v", err)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	conn := &fakeConn{rows: map[string][][]any{"SHOW server_version": {{"16.2 (Debian 16.2-1.pgdg120+2)"}}}}
+	v, err := serverVersion(context.Background(), conn)
+	if err != nil {
+		t.Fatalf("serverVersion: %v", err)
+	}
+	if v != "16.2 (Debian 16.2-1.pgdg120+2)" {
+		t.Fatalf("unexpected version %q", v)
+	}
+}